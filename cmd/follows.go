@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"paulgmiller/zebu/zebu"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//what we could figure out about an entry in a users follows, muted or blocked lists.
+type followInfo struct {
+	Follow   string //as it's stored in the list
+	Key      string
+	Name     string
+	LastPost *time.Time `json:"LastPost,omitempty"`
+	Error    string     `json:"Error,omitempty"`
+}
+
+func (f followInfo) PrettyLastPost() string {
+	if f.LastPost == nil {
+		return "never"
+	}
+	return zebu.FetchedPost{Post: zebu.Post{Created: *f.LastPost}}.PrettyCreated()
+}
+
+//resolves everyone in parallel since each one can be an ens/dns lookup and an ipfs read.
+func describeFollows(ctx context.Context, backend zebu.Backend, resolvers *zebu.ResolverChain, names []string) []followInfo {
+	infos := make([]followInfo, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			info := followInfo{Follow: name, Name: name}
+			defer func() { infos[i] = info }()
+
+			key, err := resolvers.Resolve(name)
+			if err != nil {
+				info.Error = err.Error()
+				return
+			}
+			info.Key = key
+			user, err := backend.GetUserById(ctx, key)
+			if err != nil {
+				info.Error = err.Error()
+				return
+			}
+			info.Name = user.Name()
+			if user.LastPost == "" {
+				return
+			}
+			last, err := backend.GetPost(ctx, user.LastPost)
+			if err != nil {
+				info.Error = err.Error()
+				return
+			}
+			info.LastPost = &last.Created
+		}(i, name)
+	}
+	wg.Wait()
+	return infos
+}
+
+func followspage(backend zebu.Backend, resolvers *zebu.ResolverChain, c *gin.Context) {
+	ctx := c.Request.Context()
+	me, err := reader(backend, c)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	if me.PublicKey() == "" {
+		errorPage(fmt.Errorf("connect an account to manage follows"), c)
+		return
+	}
+
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered: defaultOffered,
+		Data: gin.H{
+			"Follows":   describeFollows(ctx, backend, resolvers, me.Follows),
+			"Muted":     describeFollows(ctx, backend, resolvers, me.Muted),
+			"Blocked":   describeFollows(ctx, backend, resolvers, me.Blocked),
+			"Reader":    me.Name(),
+			"ReaderKey": me.PublicKey(),
+		},
+		HTMLName: "follows.tmpl"})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"paulgmiller/zebu/zebu"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+//how far back we look for posts only one side of a fork has.
+const forkDepth = 20
+
+//what a fork has that the record we're using doesn't.
+type forkInfo struct {
+	CID      string
+	Sequence uint64
+	Follows  []string           //followed in the fork but not by us
+	Posts    []zebu.FetchedPost //posted in the fork but not in our chain
+}
+
+func describeFork(ctx context.Context, backend zebu.Backend, resolvers *zebu.ResolverChain, current zebu.User, fork zebu.Fork) forkInfo {
+	info := forkInfo{CID: fork.Record.CID, Sequence: fork.Record.Sequence}
+	for _, f := range fork.User.Follows {
+		if !lo.Contains(current.Follows, f) {
+			info.Follows = append(info.Follows, f)
+		}
+	}
+	ours := map[string]bool{}
+	for p := range backend.GetPosts(ctx, current, forkDepth) {
+		ours[p.CID] = true
+	}
+	for p := range userPosts(ctx, backend, resolvers, fork.User, forkDepth) {
+		if !ours[p.CID] {
+			info.Posts = append(info.Posts, p)
+		}
+	}
+	sortposts(info.Posts)
+	return info
+}
+
+//shows records that conflict with a users current one so the owner can merge them.
+func forkspage(backend zebu.Backend, resolvers *zebu.ResolverChain, c *gin.Context) {
+	ctx := c.Request.Context()
+	account, err := resolvers.Resolve(c.Param("id"))
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	author, err := backend.GetUserById(ctx, account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	forks := []forkInfo{}
+	for _, f := range backend.Forks(account) {
+		forks = append(forks, describeFork(ctx, backend, resolvers, author, f))
+	}
+
+	reader, err := reader(backend, c)
+	if err != nil {
+		errorPage(fmt.Errorf("couldn't get reader %w", err), c)
+		return
+	}
+
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered: defaultOffered,
+		Data: gin.H{
+			"Forks":     forks,
+			"Author":    author.Name(),
+			"AuthorKey": author.PublicKey(),
+			"Reader":    reader.Name(),
+			"ReaderKey": reader.PublicKey(),
+		},
+		HTMLName: "forks.tmpl"})
+}
+
+//builds a record that merges a fork back in for the owner to sign.
+//lists are unioned and if the fork has posts we don't a MergePost joins its chain to ours.
+func acceptMerge(backend zebu.Backend, resolvers *zebu.ResolverChain, c *gin.Context) {
+	ctx := c.Request.Context()
+	account, faccount := c.GetPostForm("account")
+	forkcid, ffork := c.GetPostForm("fork")
+	if !faccount || !ffork {
+		errorPage(fmt.Errorf("need account and fork"), c)
+		return
+	}
+	log.Printf("got merge %s %s", account, forkcid)
+	account, err := resolvers.Resolve(account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	user, err := backend.GetUserById(ctx, account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	fork, found := lo.Find(backend.Forks(account), func(f zebu.Fork) bool { return f.Record.CID == forkcid })
+	if !found {
+		errorPage(fmt.Errorf("no fork %s for %s", forkcid, account), c)
+		return
+	}
+
+	merged := zebu.MergeUsers(user, fork.User)
+	var record zebu.UserNameRecord
+	theirs := fork.User.LastPost
+	if theirs == "" || zebu.InChain(ctx, backend, user, theirs, permalinkDepth) {
+		record, err = backend.SaveUserCid(ctx, merged)
+	} else {
+		record, err = appendPost(ctx, backend, merged, zebu.Post{
+			Kind:    zebu.MergePost,
+			Target:  theirs,
+			Created: time.Now().UTC(),
+		})
+	}
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	record.Merged = fork.Record.CID
+	c.JSON(200, record)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"paulgmiller/zebu/zebu"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+//reading every version is an ipfs read each so don't go back forever.
+const maxHistory = 50
+
+//one past record and what it changed from the one before.
+type version struct {
+	CID      string
+	Sequence uint64
+	Changes  []string
+	Current  bool
+	Error    string `json:"Error,omitempty"`
+}
+
+func historypage(backend zebu.Backend, resolvers *zebu.ResolverChain, c *gin.Context) {
+	ctx := c.Request.Context()
+	account, err := resolvers.Resolve(c.Param("id"))
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	author, err := backend.GetUserById(ctx, account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	records, err := backend.History(ctx, account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	if len(records) > maxHistory+1 {
+		records = records[:maxHistory+1]
+	}
+
+	users := make([]zebu.User, len(records))
+	errs := make([]error, len(records))
+	for i, r := range records {
+		users[i], errs[i] = zebu.ReadUser(ctx, backend, r.CID)
+	}
+	versions := []version{}
+	for i, r := range records {
+		if i == maxHistory {
+			break
+		}
+		v := version{CID: r.CID, Sequence: r.Sequence, Current: i == 0}
+		switch {
+		case errs[i] != nil:
+			v.Error = errs[i].Error()
+		case i+1 == len(records):
+			//oldest one we have so compare against nothing.
+			v.Changes = zebu.DiffUsers(zebu.User{}, users[i])
+		case errs[i+1] != nil:
+			v.Error = fmt.Sprintf("couldn't read previous version %s", errs[i+1])
+		default:
+			v.Changes = zebu.DiffUsers(users[i+1], users[i])
+		}
+		versions = append(versions, v)
+	}
+
+	reader, err := reader(backend, c)
+	if err != nil {
+		errorPage(fmt.Errorf("couldn't get reader %w", err), c)
+		return
+	}
+
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered: defaultOffered,
+		Data: gin.H{
+			"Versions":  versions,
+			"Author":    author.Name(),
+			"AuthorKey": author.PublicKey(),
+			"Reader":    reader.Name(),
+			"ReaderKey": reader.PublicKey(),
+		},
+		HTMLName: "history.tmpl"})
+}
+
+//builds a new record at the next sequence pointing at an old version for the owner to sign.
+func acceptRollback(backend zebu.Backend, resolvers *zebu.ResolverChain, c *gin.Context) {
+	ctx := c.Request.Context()
+	account, faccount := c.GetPostForm("account")
+	target, ftarget := c.GetPostForm("cid")
+	if !faccount || !ftarget {
+		errorPage(fmt.Errorf("need account and cid"), c)
+		return
+	}
+	log.Printf("got rollback %s %s", account, target)
+	account, err := resolvers.Resolve(account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	records, err := backend.History(ctx, account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	if !lo.ContainsBy(records, func(r zebu.UserNameRecord) bool { return r.CID == target }) {
+		errorPage(fmt.Errorf("%s isn't in %s's history", target, account), c)
+		return
+	}
+	old, err := zebu.ReadUser(ctx, backend, target)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	current, err := backend.GetUserById(ctx, account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	//a key revoked since then was probably revoked for a reason. Going back doesn't bring it back.
+	old.RevokedDelegates = current.RevokedDelegates
+	record, err := backend.SaveUserCid(ctx, old)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	c.JSON(200, record)
+}
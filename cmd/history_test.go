@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"paulgmiller/zebu/zebu"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+//historyBackend keeps one user's documents and history in memory. Anything else panics.
+type historyBackend struct {
+	zebu.Backend
+	docs    map[string]zebu.User
+	current string
+	history []zebu.UserNameRecord
+}
+
+func (h *historyBackend) Cat(ctx context.Context, cid string) (io.ReadCloser, error) {
+	user, found := h.docs[cid]
+	if !found {
+		return nil, fmt.Errorf("%s not found", cid)
+	}
+	data, err := json.Marshal(user)
+	return ioutil.NopCloser(bytes.NewReader(data)), err
+}
+
+func (h *historyBackend) GetUserById(ctx context.Context, id string) (zebu.User, error) {
+	return h.docs[h.current], nil
+}
+
+func (h *historyBackend) History(ctx context.Context, pubkey string) ([]zebu.UserNameRecord, error) {
+	return h.history, nil
+}
+
+func (h *historyBackend) SaveUserCid(ctx context.Context, user zebu.User) (zebu.UserNameRecord, error) {
+	cid := fmt.Sprintf("QmSaved%d", len(h.docs))
+	h.docs[cid] = user
+	return zebu.UserNameRecord{CID: cid, PubKey: user.PublicKey()}, nil
+}
+
+func TestRollbackKeepsRevocations(t *testing.T) {
+	alice := "0x5AEDA56215b167893e80B4fE645BA6d5Bab767DE"
+	backend := &historyBackend{
+		docs: map[string]zebu.User{
+			"QmOld": {PublicName: alice, Bio: "before"},
+			"QmNew": {PublicName: alice, Bio: "after", RevokedDelegates: []string{"0xSTOLEN"}},
+		},
+		current: "QmNew",
+		history: []zebu.UserNameRecord{{CID: "QmNew", Sequence: 2}, {CID: "QmOld", Sequence: 1}},
+	}
+	router := gin.New()
+	router.POST("/rollback", func(c *gin.Context) { acceptRollback(backend, zebu.NewResolverChain(zebu.KeyResolver{}), c) })
+	form := url.Values{"account": {alice}, "cid": {"QmOld"}}
+	req := httptest.NewRequest(http.MethodPost, "/rollback", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	var record zebu.UserNameRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	rolled := backend.docs[record.CID]
+	if rolled.Bio != "before" {
+		t.Fatalf("expected the old profile back got %+v", rolled)
+	}
+	if !reflect.DeepEqual(rolled.RevokedDelegates, []string{"0xSTOLEN"}) {
+		t.Fatalf("rolling back unrevoked a session key %+v", rolled)
+	}
+}
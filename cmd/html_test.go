@@ -0,0 +1,68 @@
+package main
+
+import (
+	"paulgmiller/zebu/zebu"
+	"strings"
+	"testing"
+)
+
+func TestLoadTemplates(t *testing.T) {
+	if _, err := loadTemplates(); err != nil {
+		t.Fatalf("templates didn't parse %s", err)
+	}
+}
+
+func TestGallery(t *testing.T) {
+	templates, err := loadTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := func(media []zebu.Attachment) string {
+		var out strings.Builder
+		if err := templates.ExecuteTemplate(&out, "gallery", media); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+
+	one := render(zebu.Post{Attachments: []zebu.Attachment{{CID: "QmA", Medium: "QmAMedium", Thumbnail: "QmAThumb", Alt: "a zebra", Width: 800, Height: 600}}}.Media())
+	for _, want := range []string{`class="gallery gallery-1"`, `src="/img/QmAMedium"`, `alt="a zebra"`, `width="800" height="600"`, `href="/img/QmA"`} {
+		if !strings.Contains(one, want) {
+			t.Errorf("single image gallery missing %s: %s", want, one)
+		}
+	}
+
+	legacy := render(zebu.Post{Images: []string{"QmA", "QmB", "QmC", "QmD", "QmE"}}.Media())
+	if !strings.Contains(legacy, `class="gallery gallery-many"`) || strings.Count(legacy, "data-lightbox") != 5 {
+		t.Errorf("expected a many gallery: %s", legacy)
+	}
+	if !strings.Contains(legacy, `alt="image without a description"`) {
+		t.Errorf("images need some alt: %s", legacy)
+	}
+
+	if strings.TrimSpace(render(nil)) != "" {
+		t.Errorf("no images should render nothing")
+	}
+}
+
+func TestPreviewCard(t *testing.T) {
+	templates, err := loadTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	preview := &zebu.LinkPreview{URL: "javascript:alert(1)", Title: "<b>hi</b>", Image: "QmThumb"}
+	if err := templates.ExecuteTemplate(&out, "preview", preview); err != nil {
+		t.Fatal(err)
+	}
+	card := out.String()
+	for _, want := range []string{`src="/img/QmThumb"`, `&lt;b&gt;hi&lt;/b&gt;`, `href="#ZgotmplZ"`} {
+		if !strings.Contains(card, want) {
+			t.Errorf("card missing %s: %s", want, card)
+		}
+	}
+	out.Reset()
+	if err := templates.ExecuteTemplate(&out, "preview", (*zebu.LinkPreview)(nil)); err != nil || strings.TrimSpace(out.String()) != "" {
+		t.Errorf("no preview should render nothing got %q %v", out.String(), err)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"paulgmiller/zebu/zebu"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/araddon/dateparse"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -24,7 +25,30 @@ import (
 
 const importskeypath = "import_keys"
 
-func Import(ctx context.Context, opmplpath string) ([]string, error) {
+//how long a feed's session key can sign for. Only needs to outlive one import.
+const importSessionLength = 24 * time.Hour
+
+//importSession is a throwaway key the feed's master key delegates posting to so
+//the master key only ever signs the delegation.
+type importSession struct {
+	key        *ecdsa.PrivateKey
+	delegation zebu.Delegation
+}
+
+func newImportSession(master *ecdsa.PrivateKey) (importSession, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return importSession{}, err
+	}
+	delegate := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	d, err := zebu.NewDelegation(master, delegate, time.Now().Add(importSessionLength), zebu.ScopePosts)
+	if err != nil {
+		return importSession{}, err
+	}
+	return importSession{key: key, delegation: d}, nil
+}
+
+func Import(ctx context.Context, resolvers *zebu.ResolverChain, opmplpath string) ([]string, error) {
 	importedusers := []string{}
 	doc, err := opml.NewOPMLFromFile(opmplpath)
 	if err != nil {
@@ -87,7 +111,7 @@ func Import(ctx context.Context, opmplpath string) ([]string, error) {
 			if author.DisplayName == "" {
 
 				//resolve dns?
-				dp, err := zebu.RegisterDNS(simplifyTitle(feed.Title), addr)
+				dp, err := resolvers.Register(simplifyTitle(feed.Title), addr)
 				if err != nil {
 					log.Println(err.Error())
 					continue
@@ -95,18 +119,23 @@ func Import(ctx context.Context, opmplpath string) ([]string, error) {
 				author.DisplayName = dp
 			}
 			author.ImportSource = trimurl
+			session, err := newImportSession(privatekey)
+			if err != nil {
+				log.Printf("couldn't delegate for %s, %s", feed.XMLURL, err)
+				continue
+			}
 			importedusers = append(importedusers, author.DisplayName)
 			wg.Add(1)
 			go func(url string) {
 				defer wg.Done()
 				log.Printf("crawling %s, %s", u.Host, url)
-				post, err := Crawl(ctx, url, author, b)
+				post, err := Crawl(ctx, url, author, b, session)
 				if err != nil {
 					log.Println(err.Error())
 					return
 				}
 				author.LastPost = post
-				err = publishWithKey(ctx, author, b, privatekey)
+				err = publishWithKey(ctx, author, b, session.key, &session.delegation)
 				if err != nil {
 					log.Println(err.Error())
 					return
@@ -131,13 +160,34 @@ func simplifyTitle(title string) string {
 	return b.String()
 }
 
-func publishWithKey(ctx context.Context, author zebu.User, b zebu.UserBackend, privatekey *ecdsa.PrivateKey) error {
+//publishWithKey signs with privatekey, as the delegate in d if there is one.
+func publishWithKey(ctx context.Context, author zebu.User, b zebu.UserBackend, privatekey *ecdsa.PrivateKey, d *zebu.Delegation) error {
+	return publish(ctx, author, b, func(unr *zebu.UserNameRecord) error {
+		unr.Scheme = zebu.EIP712ChainScheme
+		if d != nil {
+			return unr.SignDelegated(privatekey, *d)
+		}
+		return unr.Sign(privatekey)
+	})
+}
+
+//publishWithSigner is for keys that aren't ethereum's and can only sign legacy records.
+func publishWithSigner(ctx context.Context, author zebu.User, b zebu.UserBackend, s zebu.Signer) error {
+	if eth, ok := s.(zebu.EthereumSigner); ok {
+		return publishWithKey(ctx, author, b, eth.Key, nil)
+	}
+	return publish(ctx, author, b, func(unr *zebu.UserNameRecord) error {
+		unr.Previous = "" //legacy records can't carry it
+		return unr.SignWith(s)
+	})
+}
+
+func publish(ctx context.Context, author zebu.User, b zebu.UserBackend, sign func(*zebu.UserNameRecord) error) error {
 	unr, err := b.SaveUserCid(ctx, author) //not blocking yet.
 	if err != nil {
 		return fmt.Errorf("could not save %v, %w", author, err)
 	}
-
-	if err := unr.Sign(privatekey); err != nil {
+	if err := sign(&unr); err != nil {
 		return err
 	}
 
@@ -153,7 +203,7 @@ func publishWithKey(ctx context.Context, author zebu.User, b zebu.UserBackend, p
 
 //TODO https://blog.acolyer.org/feed/ (the morning paper) doesn't seem to parse right.
 
-func Crawl(ctx context.Context, xmlurl string, author zebu.User, b zebu.Backend) (string, error) {
+func Crawl(ctx context.Context, xmlurl string, author zebu.User, b zebu.Backend, session importSession) (string, error) {
 	log.Printf("fetching %s", xmlurl)
 	fp := gofeed.NewParser()
 	fp.UserAgent = "github.com/paulgmiller/zebu"
@@ -166,7 +216,7 @@ func Crawl(ctx context.Context, xmlurl string, author zebu.User, b zebu.Backend)
 
 	oldposts := map[string]zebu.Post{}
 	for p := range exisitngposts {
-		oldposts[p.Content] = p
+		oldposts[p.Content] = p.Post
 	}
 
 	previous := ""
@@ -199,6 +249,10 @@ func Crawl(ctx context.Context, xmlurl string, author zebu.User, b zebu.Backend)
 				Content:  cid,
 				Created:  time,
 			}
+			post.Delegation = &session.delegation
+			if err := post.Sign(session.key); err != nil {
+				return "", err
+			}
 		}
 		previous, err = b.SavePost(ctx, post)
 		if err != nil {
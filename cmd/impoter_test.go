@@ -1,6 +1,14 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"crypto/ed25519"
+	"paulgmiller/zebu/zebu"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
 
 func TestSimplifyTitle(t *testing.T) {
 	simple := simplifyTitle("Scott Hanselman's Computer Zen")
@@ -8,3 +16,61 @@ func TestSimplifyTitle(t *testing.T) {
 		t.Fatalf("blargh %s", simple)
 	}
 }
+
+//publishBackend remembers what got published. Anything else panics.
+type publishBackend struct {
+	zebu.UserBackend
+	published []zebu.UserNameRecord
+}
+
+func (p *publishBackend) SaveUserCid(ctx context.Context, user zebu.User) (zebu.UserNameRecord, error) {
+	return zebu.UserNameRecord{CID: "QmImported", Sequence: 2, PubKey: user.PublicKey(), Previous: "QmOlder"}, nil
+}
+
+func (p *publishBackend) PublishUser(ctx context.Context, unr zebu.UserNameRecord) error {
+	p.published = append(p.published, unr)
+	return nil
+}
+
+func TestImportSessionSigns(t *testing.T) {
+	master, _ := crypto.GenerateKey()
+	owner := zebu.User{PublicName: crypto.PubkeyToAddress(master.PublicKey).Hex()}
+	session, err := newImportSession(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.delegation.Check(owner.PublicKey(), time.Now()); err != nil {
+		t.Fatalf("master should have delegated to the session, %v", err)
+	}
+	if session.delegation.Delegate == owner.PublicKey() {
+		t.Fatalf("session key shouldn't be the master key")
+	}
+
+	post := zebu.Post{Content: "QmItem", Created: time.Now(), Delegation: &session.delegation}
+	if err := post.Sign(session.key); err != nil {
+		t.Fatal(err)
+	}
+	if status := post.SignatureStatusFor(owner); status != zebu.SignatureValid {
+		t.Fatalf("delegated post should be %s got %s", zebu.SignatureValid, status)
+	}
+
+	backend := &publishBackend{}
+	if err := publishWithKey(context.Background(), owner, backend, session.key, &session.delegation); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.published) != 1 || backend.published[0].Delegation == nil || backend.published[0].Delegation.Delegate != session.delegation.Delegate {
+		t.Fatalf("expected one record signed by the session got %+v", backend.published)
+	}
+}
+
+func TestPublishWithSigner(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(nil)
+	signer := zebu.Ed25519Signer{Key: key}
+	backend := &publishBackend{}
+	if err := publishWithSigner(context.Background(), zebu.User{PublicName: signer.PublicKey()}, backend, signer); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.published) != 1 || backend.published[0].Scheme != zebu.LegacyScheme || backend.published[0].Previous != "" {
+		t.Fatalf("expected one legacy record without Previous got %+v", backend.published)
+	}
+}
@@ -3,9 +3,14 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
+	"os"
 	"paulgmiller/zebu/zebu"
+	"strings"
 	//https://pkg.go.dev/github.com/ipfs/go-ipfs-api#Key
+
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 const nobody = "nobody"
@@ -15,25 +20,48 @@ func main() {
 	//https://github.com/spf13/viper
 	resolve := flag.String("resolve", nobody, "look them up")
 	opmlpath := flag.String("import", "", "import an opml feed")
-	//unfollow := flag.String("unfollow", "nobody", "remove somone to your follows")
+	unfollow := flag.String("unfollow", nobody, "remove somone from your follows")
+	keyfile := flag.String("key", "", "private key file to sign changes like -unfollow with")
+	keytype := flag.String("keytype", "ethereum", "what's in -key. ethereum (hex ecdsa), ed25519 (hex seed) or libp2p (an ipfs config's Identity.PrivKey)")
+	order := flag.String("resolvers", defaultResolvers, "comma separated resolvers to try names with in order")
+	aliases := flag.String("aliases", "", "file of local names, a name and a key on each line")
+	ethendpoint := flag.String("ethendpoint", os.Getenv("ETHENDPOINT"), "ethereum rpc endpoint for ens")
 	flag.Parse()
 	ctx := context.Background()
 
+	registerendpoint, ok := os.LookupEnv("REGISTERENDPOINT")
+	if !ok {
+		//turn off on non prod
+		registerendpoint = "northbriton"
+	}
+	resolvers, err := resolverChain(*order, *aliases, *ethendpoint, registerendpoint)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
 	if *resolve != nobody {
-		hash, err := zebu.Resolve(*resolve)
+		resolution, err := resolvers.Resolution(*resolve)
 		if err != nil {
 			panic(err)
 		}
-		log.Println(hash)
+		log.Printf("%s (%s)", resolution.Key, resolution.Resolver)
 		return
 	}
 
 	backend := zebu.NewIpfsBackend(ctx)
 
+	if *unfollow != nobody {
+		if err := unfollowWithKey(ctx, backend, *keytype, *keyfile, *unfollow); err != nil {
+			log.Fatal(err.Error())
+		}
+		log.Printf("unfollowed %s", *unfollow)
+		return
+	}
+
 	if *opmlpath != "" {
 		log.Printf("opmlpath %s", *opmlpath)
 
-		imports, err := Import(ctx, *opmlpath)
+		imports, err := Import(ctx, resolvers, *opmlpath)
 		if err != nil {
 			log.Fatal(err.Error())
 		}
@@ -41,5 +69,83 @@ func main() {
 		return
 	}
 
-	serve(backend)
+	serve(ctx, backend, resolvers)
+}
+
+//the order names are tried in. Keys first since they're free, dns last since anything with a dot might be a domain.
+const defaultResolvers = "address,did:pkh,alias,ens,dnslink"
+
+//resolverChain builds the resolvers named in order. alias is skipped without an alias file
+//and ens without an endpoint fails .eth names instead of sending them to dns.
+func resolverChain(order, aliasfile, ethendpoint, registerendpoint string) (*zebu.ResolverChain, error) {
+	resolvers := []zebu.Resolver{}
+	for _, name := range strings.Split(order, ",") {
+		switch strings.TrimSpace(name) {
+		case "address":
+			resolvers = append(resolvers, zebu.KeyResolver{})
+		case "did:pkh":
+			resolvers = append(resolvers, zebu.DidPkhResolver{})
+		case "alias":
+			if aliasfile == "" {
+				continue
+			}
+			aliases, err := zebu.LoadAliases(aliasfile)
+			if err != nil {
+				return nil, err
+			}
+			resolvers = append(resolvers, aliases)
+		case "ens":
+			var client *zebu.EnsClient
+			if ethendpoint != "" {
+				var err error
+				if client, err = zebu.DialEns(ethendpoint); err != nil {
+					return nil, err
+				}
+			}
+			resolvers = append(resolvers, zebu.NewEnsResolver(client))
+		case "dnslink":
+			resolvers = append(resolvers, zebu.NewDNSLinkResolver(registerendpoint))
+		default:
+			return nil, fmt.Errorf("no resolver called %s", name)
+		}
+	}
+	return zebu.NewResolverChain(resolvers...), nil
+}
+
+//loadSigner reads keyfile as keytype.
+func loadSigner(keytype, keyfile string) (zebu.Signer, error) {
+	if keyfile == "" {
+		return nil, fmt.Errorf("need -key to sign with")
+	}
+	if keytype == "ethereum" {
+		privatekey, err := crypto.LoadECDSA(keyfile)
+		if err != nil {
+			return nil, err
+		}
+		return zebu.EthereumSigner{Key: privatekey}, nil
+	}
+	contents, err := os.ReadFile(keyfile)
+	if err != nil {
+		return nil, err
+	}
+	switch keytype {
+	case "ed25519":
+		return zebu.NewEd25519Signer(string(contents))
+	case "libp2p":
+		return zebu.NewLibp2pSigner(string(contents))
+	}
+	return nil, fmt.Errorf("no key type called %s", keytype)
+}
+
+func unfollowWithKey(ctx context.Context, backend zebu.Backend, keytype, keyfile, followee string) error {
+	signer, err := loadSigner(keytype, keyfile)
+	if err != nil {
+		return err
+	}
+	user, err := backend.GetUserById(ctx, signer.PublicKey())
+	if err != nil {
+		return err
+	}
+	user.Unfollow(followee)
+	return publishWithSigner(ctx, user, backend, signer)
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	p2pcrypto "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+func TestResolverChain(t *testing.T) {
+	resolvers, err := resolverChain(defaultResolvers, "", "", "northbriton")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//no alias file so no alias resolver.
+	if got := resolvers.Resolvers(); !reflect.DeepEqual(got, []string{"address", "did:pkh", "ens", "dnslink"}) {
+		t.Fatalf("wrong chain %v", got)
+	}
+	if _, err := resolverChain("address,carrierpigeon", "", "", "northbriton"); err == nil {
+		t.Fatalf("unknown resolvers should be an error")
+	}
+}
+
+func TestLoadSigner(t *testing.T) {
+	dir := t.TempDir()
+	eth, _ := crypto.GenerateKey()
+	if err := crypto.SaveECDSA(filepath.Join(dir, "ethereum"), eth); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ed25519"), []byte(strings.Repeat("ab", 32)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p2p, _, _ := p2pcrypto.GenerateKeyPair(p2pcrypto.Ed25519, -1)
+	keybytes, _ := p2pcrypto.MarshalPrivateKey(p2p)
+	if err := os.WriteFile(filepath.Join(dir, "libp2p"), []byte(p2pcrypto.ConfigEncodeKey(keybytes)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	prefixes := map[string]string{"ethereum": "0x", "ed25519": "ed25519:", "libp2p": "libp2p:"}
+	for keytype, prefix := range prefixes {
+		signer, err := loadSigner(keytype, filepath.Join(dir, keytype))
+		if err != nil {
+			t.Fatalf("couldn't load %s key, %v", keytype, err)
+		}
+		if !strings.HasPrefix(signer.PublicKey(), prefix) {
+			t.Errorf("%s key should start %s got %s", keytype, prefix, signer.PublicKey())
+		}
+	}
+	if _, err := loadSigner("rsa", filepath.Join(dir, "ethereum")); err == nil {
+		t.Fatalf("unknown key types should be an error")
+	}
+	if _, err := loadSigner("libp2p", filepath.Join(dir, "ed25519")); err == nil {
+		t.Fatalf("an ed25519 seed isn't a libp2p key")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"paulgmiller/zebu/zebu"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	cidlib "github.com/ipfs/go-cid"
+)
+
+//what we're willing to serve as itself. Anything else (html, svg, scripts) would run on our origin so it's just bytes.
+var mediaTypes = []string{"image/", "video/", "audio/"}
+
+func mediaType(sniff []byte) string {
+	ctype := http.DetectContentType(sniff)
+	for _, m := range mediaTypes {
+		if strings.HasPrefix(ctype, m) {
+			return ctype
+		}
+	}
+	return "application/octet-stream"
+}
+
+//streams images, video and audio straight from ipfs with range support.
+//a cid never changes so it's the etag and browsers can keep it forever.
+func media(backend zebu.ContentBackend, c *gin.Context) {
+	cid := c.Param("cidr")
+	if _, err := cidlib.Parse(cid); err != nil {
+		c.String(http.StatusBadRequest, "bad cid %s", cid)
+		return
+	}
+	etag := `"` + cid + `"`
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	f, err := backend.Open(c.Request.Context(), cid)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	defer f.Close()
+
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(f, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		errorPage(err, c)
+		return
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		errorPage(err, c)
+		return
+	}
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", mediaType(sniff[:n]))
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, f)
+}
+
+//mediaItem is an attachment with urls so clients don't need to know our routes.
+type mediaItem struct {
+	zebu.Attachment
+	URL          string
+	MediumURL    string
+	ThumbnailURL string
+}
+
+//postMedia lists a post's images for clients building their own galleries. Legacy posts just get CIDs.
+//Like the permalink it's what the author last left, so an edit swaps the images and a delete empties it.
+func postMedia(backend zebu.Backend, resolvers *zebu.ResolverChain, c *gin.Context) {
+	ctx := c.Request.Context()
+	cid := c.Param("cid")
+	if _, err := cidlib.Parse(cid); err != nil {
+		c.String(http.StatusBadRequest, "bad cid %s", cid)
+		return
+	}
+	raw, err := backend.GetPost(ctx, cid)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	author, err := backend.GetUserById(ctx, postAuthorKey(resolvers, raw))
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	post, _, err := revisedPost(ctx, backend, author, cid)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	items := []mediaItem{}
+	for _, a := range post.Media() {
+		items = append(items, mediaItem{
+			Attachment:   a,
+			URL:          absoluteURL(c, "/media/"+a.CID),
+			MediumURL:    absoluteURL(c, "/media/"+a.Medium),
+			ThumbnailURL: absoluteURL(c, "/media/"+a.Thumbnail),
+		})
+	}
+	//edits and deletes change what a post shows so it can't be cached like the media itself.
+	c.Header("Cache-Control", "public, max-age=60")
+	c.JSON(http.StatusOK, gin.H{"CID": cid, "Media": items})
+}
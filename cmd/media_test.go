@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"paulgmiller/zebu/zebu"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	pngCID  = "QmP95DscnxiNzzDJ7wcivJNKe1xNCRzxh8Td9Uo5focKpZ"
+	htmlCID = "QmYpdmbS3m677XLjixE6YkeMxCcnAvxmksWiubK4pigiFw"
+)
+
+//only Open, Add, Remove, GetPost and GetUserById are implemented. Anything else panics which is what we want if media starts using it.
+type mediaBackend struct {
+	zebu.Backend
+	objects map[string][]byte
+	posts   map[string]zebu.Post
+	users   map[string]zebu.User
+	opened  int
+}
+
+type nopSeekCloser struct{ *bytes.Reader }
+
+func (nopSeekCloser) Close() error { return nil }
+
+func (m *mediaBackend) Open(ctx context.Context, cid string) (io.ReadSeekCloser, error) {
+	m.opened++
+	data, found := m.objects[cid]
+	if !found {
+		return nil, fmt.Errorf("%s not found", cid)
+	}
+	return nopSeekCloser{bytes.NewReader(data)}, nil
+}
+
+func (m *mediaBackend) Add(ctx context.Context, r io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	cid := fmt.Sprintf("QmUploaded%d", len(m.objects))
+	m.objects[cid] = data
+	return cid, nil
+}
+
+func (m *mediaBackend) Remove(ctx context.Context, cid string) error {
+	delete(m.objects, cid)
+	return nil
+}
+
+func (m *mediaBackend) GetPost(ctx context.Context, cid string) (zebu.Post, error) {
+	post, found := m.posts[cid]
+	if !found {
+		return post, fmt.Errorf("%s not found", cid)
+	}
+	return post, nil
+}
+
+func (m *mediaBackend) GetUserById(ctx context.Context, id string) (zebu.User, error) {
+	if user, found := m.users[id]; found {
+		return user, nil
+	}
+	return zebu.User{PublicName: id}, nil
+}
+
+func serveMedia(backend *mediaBackend, cid string, headers map[string]string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.GET("/media/:cidr", func(c *gin.Context) { media(backend, c) })
+	req := httptest.NewRequest(http.MethodGet, "/media/"+cid, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestMedia(t *testing.T) {
+	png := append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), bytes.Repeat([]byte{7}, 1000)...)
+	backend := &mediaBackend{objects: map[string][]byte{
+		pngCID:  png,
+		htmlCID: []byte("<html><script>alert(1)</script></html>"),
+	}}
+
+	w := serveMedia(backend, pngCID, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("ETag") != `"`+pngCID+`"` || w.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" {
+		t.Fatalf("bad caching headers %v", w.Header())
+	}
+	if !bytes.Equal(w.Body.Bytes(), png) {
+		t.Fatalf("body didn't match")
+	}
+
+	w = serveMedia(backend, pngCID, map[string]string{"Range": "bytes=8-11"})
+	body, _ := ioutil.ReadAll(w.Body)
+	if w.Code != http.StatusPartialContent || !bytes.Equal(body, png[8:12]) {
+		t.Fatalf("range got %d %v", w.Code, body)
+	}
+	if w.Header().Get("Content-Range") != fmt.Sprintf("bytes 8-11/%d", len(png)) {
+		t.Fatalf("bad content range %s", w.Header().Get("Content-Range"))
+	}
+
+	opened := backend.opened
+	w = serveMedia(backend, pngCID, map[string]string{"If-None-Match": `"` + pngCID + `"`})
+	if w.Code != http.StatusNotModified || backend.opened != opened {
+		t.Fatalf("expected 304 without reading got %d", w.Code)
+	}
+
+	w = serveMedia(backend, htmlCID, nil)
+	if w.Header().Get("Content-Type") != "application/octet-stream" || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("html served as %s", w.Header().Get("Content-Type"))
+	}
+
+	if w = serveMedia(backend, "notacid", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad cid got %d", w.Code)
+	}
+}
+
+func TestPostMedia(t *testing.T) {
+	alice := "0x5AEDA56215b167893e80B4fE645BA6d5Bab767DE"
+	const (
+		editCID    = "QmZTR5bcpQD7cFgTorqxZDYaew1Wqgfbd2ud9QqGPAkK2V"
+		deletedCID = "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"
+		deleteCID  = "QmTkzDwWqPbnAh5YiV5VwcTLnGdwSNsNTn2aDxdXBFca7D"
+	)
+	now := time.Now()
+	backend := &mediaBackend{
+		posts: map[string]zebu.Post{
+			pngCID:     {Author: alice, Created: now.Add(-3 * time.Minute), Images: []string{"QmA"}, Attachments: []zebu.Attachment{{CID: "QmA", Type: "image/png", Alt: "a zebra", Thumbnail: "QmAThumb"}}},
+			deletedCID: {Author: alice, Created: now.Add(-2 * time.Minute), Previous: pngCID, Images: []string{"QmB"}},
+			deleteCID:  {Author: alice, Created: now.Add(-1 * time.Minute), Previous: deletedCID, Kind: zebu.DeletePost, Target: deletedCID},
+			editCID:    {Author: alice, Created: now, Previous: deleteCID, Kind: zebu.EditPost, Target: pngCID, Images: []string{"QmC"}, Attachments: []zebu.Attachment{{CID: "QmC", Type: "image/png", Alt: "two zebras"}}},
+		},
+		users: map[string]zebu.User{alice: {PublicName: alice, LastPost: editCID}},
+	}
+	resolvers := zebu.NewResolverChain(zebu.KeyResolver{})
+	router := gin.New()
+	router.GET("/post/:cid/media", func(c *gin.Context) { postMedia(backend, resolvers, c) })
+	get := func(cid string) []mediaItem {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://zebu.test/post/"+cid+"/media", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d %s", w.Code, w.Body.String())
+		}
+		if strings.Contains(w.Header().Get("Cache-Control"), "immutable") {
+			t.Fatalf("edits change the media so it isn't immutable")
+		}
+		var got struct {
+			CID   string
+			Media []mediaItem
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.CID != cid {
+			t.Fatalf("got %+v", got)
+		}
+		return got.Media
+	}
+
+	media := get(pngCID)
+	if len(media) != 1 {
+		t.Fatalf("got %+v", media)
+	}
+	m := media[0]
+	if m.Alt != "two zebras" || m.URL != "http://zebu.test/media/QmC" || m.MediumURL != "http://zebu.test/media/QmC" || m.ThumbnailURL != "http://zebu.test/media/QmC" {
+		t.Fatalf("expected the edited image got %+v", m)
+	}
+	if media := get(deletedCID); len(media) != 0 {
+		t.Fatalf("deleted post still has media %+v", media)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"paulgmiller/zebu/zebu"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const notificationPageSize = 20
+
+//notice is a post in someone's notifications and why it's there.
+type notice struct {
+	Reason string
+	Post   zebu.FetchedPost
+}
+
+//notificationspage is the replies and mentions of the reader we've indexed, newest first, a page at a time.
+func notificationspage(backend zebu.Backend, resolvers *zebu.ResolverChain, index *zebu.PostIndex, c *gin.Context) {
+	ctx := c.Request.Context()
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.String(http.StatusBadRequest, "bad page %s", c.Query("page"))
+		return
+	}
+
+	reader, err := reader(backend, c)
+	if err != nil {
+		errorPage(fmt.Errorf("couldn't get reader %w", err), c)
+		return
+	}
+	hide := newHider(resolvers, reader)
+
+	notifications, total := []zebu.Notification{}, 0
+	if reader.PublicKey() != "" {
+		notifications, total = index.Notifications(reader.PublicKey(), (page-1)*notificationPageSize, notificationPageSize)
+	}
+	notices := []notice{}
+	for _, n := range notifications {
+		if hide.hides(n.Author) {
+			continue
+		}
+		p, err := fetchPost(ctx, backend, resolvers, n.PostRef)
+		if err != nil {
+			log.Printf("couldn't fetch notification %s, %s", n.CID, err)
+			continue
+		}
+		if hide.hidden(p) {
+			continue
+		}
+		notices = append(notices, notice{Reason: n.Reason, Post: p})
+	}
+
+	data := gin.H{
+		"Notifications": notices,
+		"Page":          page,
+		"Total":         total,
+		"Reader":        reader.Name(),
+		"ReaderKey":     reader.PublicKey(),
+	}
+	if page > 1 {
+		data["PrevPage"] = page - 1
+	}
+	if page*notificationPageSize < total {
+		data["NextPage"] = page + 1
+	}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered:  defaultOffered,
+		Data:     data,
+		HTMLName: "notifications.tmpl"})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"paulgmiller/zebu/zebu"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+//how far back in the authors chain we look before calling a post unverified.
+const permalinkDepth = 50
+
+//posts only claim an author by name so do our best to turn it into a key.
+func postAuthorKey(resolvers *zebu.ResolverChain, post zebu.Post) string {
+	if post.Author == "" {
+		return ""
+	}
+	key, err := resolvers.Resolve(post.Author)
+	if err != nil {
+		log.Printf("couldn't resolve post author %s, %s", post.Author, err)
+		return post.Author
+	}
+	return key
+}
+
+var tags = regexp.MustCompile(`<[^>]*>`)
+
+//plain text version of rendered content for places like og:description that can't take html.
+func excerpt(content template.HTML, max int) string {
+	text := html.UnescapeString(tags.ReplaceAllString(string(content), " "))
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:max])) + "…"
+}
+
+//opengraph wants absolute urls.
+func absoluteURL(c *gin.Context, path string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, c.Request.Host, path)
+}
+
+//a single post by itself so you can link to it.
+func postpage(backend zebu.Backend, resolvers *zebu.ResolverChain, c *gin.Context) {
+	ctx := c.Request.Context()
+	cid := c.Param("cid")
+
+	raw, err := backend.GetPost(ctx, cid)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	authorkey := postAuthorKey(resolvers, raw)
+	author, err := backend.GetUserById(ctx, authorkey)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	//anyone can claim to be anyone in a post so make sure the author actually chained it.
+	//Walking their chain is also how we find edits and deletes.
+	revised, inchain, err := revisedPost(ctx, backend, author, cid)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	if !inchain {
+		log.Printf("%s claims %s but isn't in their chain", cid, authorkey)
+	}
+
+	post := renderPost(ctx, backend, resolvers, withAuthor(resolvers, revised, author))
+
+	reader, err := reader(backend, c)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+
+	og := gin.H{
+		"Title":       fmt.Sprintf("%s on zebu", post.Author),
+		"Description": excerpt(post.RenderedContent, 200),
+		"URL":         absoluteURL(c, "/post/"+cid),
+	}
+	if media := post.Media(); len(media) > 0 {
+		og["Image"] = absoluteURL(c, "/img/"+media[0].Medium)
+		og["ImageAlt"] = media[0].Alt
+	}
+
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered: defaultOffered,
+		Data: gin.H{
+			"Post":      post,
+			"AuthorKey": author.PublicKey(),
+			"InChain":   inchain,
+			"OpenGraph": og,
+			"Reader":    reader.Name(),
+			"ReaderKey": reader.PublicKey(),
+		},
+		HTMLName: "post.tmpl"})
+}
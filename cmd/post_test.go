@@ -0,0 +1,14 @@
+package main
+
+import "testing"
+
+func TestExcerpt(t *testing.T) {
+	e := excerpt(`<a href="http://x">Title</a><br/>some &amp; more   text`, 100)
+	if e != "Title some & more text" {
+		t.Fatalf("bad excerpt %q", e)
+	}
+	e = excerpt("abcdefghij", 4)
+	if e != "abcd…" {
+		t.Fatalf("bad truncation %q", e)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"paulgmiller/zebu/zebu"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxBio   = 500 //characters
+	maxLinks = 5
+)
+
+//what the user page shows about someone on top of their posts.
+type profile struct {
+	Avatar  string //ready for an img src
+	Bio     string
+	Links   []string
+	EnsName string            `json:"EnsName,omitempty"` //for someone who's only an address
+	Pinned  *zebu.FetchedPost `json:"Pinned,omitempty"`
+}
+
+//avatarSrc turns an avatar into something an img tag can use.
+//ours are image CIDs but ens avatars can be ipfs uris too. Urls never go in an img, see ensAvatarSrc.
+func avatarSrc(avatar string) string {
+	switch {
+	case avatar == "":
+		return ""
+	case strings.HasPrefix(avatar, "ipfs://"):
+		return "/img/" + strings.TrimPrefix(strings.TrimPrefix(avatar, "ipfs://"), "ipfs/")
+	case strings.Contains(avatar, ":"):
+		//nft avatars (eip155:1/erc721:...) need a contract call we don't do yet.
+		return ""
+	}
+	return "/img/" + avatar
+}
+
+//ensAvatarSrc is avatarSrc for ens avatars which can be any https url. Readers' browsers would tell whoever
+//runs the site what they're looking at so those are served from our copy once we have one.
+func ensAvatarSrc(avatars *zebu.Avatars, avatar string) string {
+	if !strings.HasPrefix(avatar, "https://") {
+		return avatarSrc(avatar)
+	}
+	if cid := avatars.CID(avatar); cid != "" {
+		return "/img/" + cid
+	}
+	return ""
+}
+
+//fills in who wrote a post for the post partial.
+func withAuthor(resolvers *zebu.ResolverChain, p zebu.FetchedPost, author zebu.User) zebu.FetchedPost {
+	p.Author = author.Name()
+	//raw addresses are unreadable so show their ens name if they've set one.
+	if author.DisplayName == "" {
+		p.AuthorEnsName = resolvers.NameOf(author.PublicKey())
+	}
+	p.AuthorAvatar = avatarSrc(author.Avatar)
+	p.AuthorBio = author.Bio
+	return p
+}
+
+//falls back to ens avatar, description and url text records for anything the user hasn't set themselves.
+//Someone who's only an address gets their primary ens name if they have one.
+func describeProfile(ctx context.Context, backend zebu.Backend, resolvers *zebu.ResolverChain, avatars *zebu.Avatars, user zebu.User) profile {
+	p := profile{Avatar: avatarSrc(user.Avatar), Bio: user.Bio, Links: user.Links}
+	ensname := ""
+	switch {
+	case strings.HasSuffix(user.DisplayName, ".eth"):
+		ensname = user.DisplayName
+	case user.DisplayName == "":
+		p.EnsName = resolvers.NameOf(user.PublicKey())
+		ensname = p.EnsName
+	}
+	if ensname != "" && (p.Avatar == "" || p.Bio == "" || len(p.Links) == 0) {
+		texts, err := resolvers.Text(ensname, zebu.EnsProfileKeys...)
+		if err != nil {
+			log.Printf("couldn't get ens profile for %s, %s", ensname, err)
+		} else {
+			if p.Avatar == "" {
+				p.Avatar = ensAvatarSrc(avatars, texts["avatar"])
+			}
+			if p.Bio == "" {
+				p.Bio = texts["description"]
+			}
+			if links, err := checkLinks(texts["url"]); err == nil && len(p.Links) == 0 {
+				p.Links = links
+			}
+		}
+	}
+	if user.PinnedPost != "" {
+		pinned, err := fetchPost(ctx, backend, resolvers, zebu.PostRef{CID: user.PinnedPost, Author: user.PublicKey()})
+		if err != nil {
+			log.Printf("couldn't get pinned post %s, %s", user.PinnedPost, err)
+		} else if !pinned.Deleted {
+			pinned = withAuthor(resolvers, pinned, user)
+			p.Pinned = &pinned
+		}
+	}
+	return p
+}
+
+//only http(s) so a link can't be javascript.
+func checkLinks(text string) ([]string, error) {
+	links := []string{}
+	for _, l := range strings.Split(text, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		u, err := url.Parse(l)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%s isn't an http link", l)
+		}
+		links = append(links, u.String())
+	}
+	if len(links) > maxLinks {
+		return nil, fmt.Errorf("only %d links allowed", maxLinks)
+	}
+	return links, nil
+}
+
+//updates whichever profile fields were sent and returns the record to sign.
+func acceptProfile(backend zebu.Backend, resolvers *zebu.ResolverChain, c *gin.Context) {
+	ctx := c.Request.Context()
+	form, err := c.MultipartForm()
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	if len(form.Value["account"]) == 0 {
+		errorPage(fmt.Errorf("need account"), c)
+		return
+	}
+	account, err := resolvers.Resolve(form.Value["account"][0])
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	user, err := backend.GetUserById(ctx, account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+
+	if bio, found := form.Value["bio"]; found {
+		user.Bio = strings.TrimSpace(bio[0])
+		if utf8.RuneCountInString(user.Bio) > maxBio {
+			errorPage(fmt.Errorf("bio is longer than %d characters", maxBio), c)
+			return
+		}
+	}
+	if links, found := form.Value["links"]; found {
+		if user.Links, err = checkLinks(links[0]); err != nil {
+			errorPage(err, c)
+			return
+		}
+	}
+	if pinned, found := form.Value["pinned"]; found {
+		user.PinnedPost = strings.TrimSpace(pinned[0])
+		if user.PinnedPost != "" && !zebu.InChain(ctx, backend, user, user.PinnedPost, permalinkDepth) {
+			errorPage(fmt.Errorf("%s isn't one of %s's posts", user.PinnedPost, user.Name()), c)
+			return
+		}
+	}
+	if len(form.File["avatar"]) > 0 {
+		f, err := form.File["avatar"][0].Open()
+		if err != nil {
+			errorPage(err, c)
+			return
+		}
+		avatar, err := zebu.SaveImage(ctx, backend, f)
+		f.Close()
+		if err != nil {
+			errorPage(err, c)
+			return
+		}
+		//avatars are never shown big so the thumbnail is plenty.
+		user.Avatar = avatar.CID
+		if avatar.Thumbnail != "" {
+			user.Avatar = avatar.Thumbnail
+		}
+	}
+
+	record, err := backend.SaveUserCid(ctx, user)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	c.JSON(200, record)
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestAvatarSrc(t *testing.T) {
+	cases := map[string]string{
+		"":                        "",
+		"QmAvatar":                "/img/QmAvatar",
+		"ipfs://QmENS":            "/img/QmENS",
+		"ipfs://ipfs/Qm":          "/img/Qm",
+		"https://x/a.png":         "",
+		"http://x/a.png":          "",
+		"eip155:1/erc721:0xabc/1": "",
+	}
+	for avatar, want := range cases {
+		if got := avatarSrc(avatar); got != want {
+			t.Errorf("avatarSrc(%q) = %q wanted %q", avatar, got, want)
+		}
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	links, err := checkLinks("https://northbriton.net\n\n  http://example.com/x  \n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 || links[1] != "http://example.com/x" {
+		t.Fatalf("bad links %v", links)
+	}
+	for _, bad := range []string{"javascript:alert(1)", "ftp://x", "not a link", "https://"} {
+		if _, err := checkLinks(bad); err == nil {
+			t.Errorf("accepted %q", bad)
+		}
+	}
+	if _, err := checkLinks("https://a\nhttps://b\nhttps://c\nhttps://d\nhttps://e\nhttps://f"); err == nil {
+		t.Errorf("accepted too many links")
+	}
+}
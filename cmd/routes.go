@@ -1,18 +1,22 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"paulgmiller/zebu/zebu"
 	"sort"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/samber/lo"
@@ -28,7 +32,14 @@ func replaceUrlKeys(c *gin.Context) string {
 	return url
 }
 
-func serve(backend zebu.Backend) {
+func serve(ctx context.Context, backend zebu.Backend, resolvers *zebu.ResolverChain) {
+	index := zebu.NewPostIndex(backend, 20, resolvers.Resolve)
+	go index.Run(ctx, time.Minute)
+	uploads := zebu.NewUploads(backend, zebu.DailyUploadQuota)
+	go uploads.Run(ctx, time.Minute)
+	previews := zebu.NewPreviewFetcher()
+	avatars := zebu.NewAvatars(previews, backend)
+
 	router := gin.New()
 	router.Use(gin.LoggerWithConfig(gin.LoggerConfig{SkipPaths: []string{"/healthz"}}), gin.Recovery())
 
@@ -45,24 +56,50 @@ func serve(backend zebu.Backend) {
 	router.GET("/", func(c *gin.Context) {
 		account, err := c.Cookie("zebu_account")
 		if err == http.ErrNoCookie {
-			rand(backend, c)
+			rand(backend, resolvers, c)
 			return
 		}
-		userfeed(backend, c, account)
+		userfeed(backend, resolvers, c, account)
 	})
 
 	router.GET("/rand", func(c *gin.Context) {
-		rand(backend, c)
+		rand(backend, resolvers, c)
 	})
 
 	router.POST("/post", func(c *gin.Context) {
-		acceptPost(backend, c)
+		acceptPost(backend, resolvers, uploads, previews, c)
+	})
+
+	router.POST("/publish", func(c *gin.Context) {
+		publishPost(backend, resolvers, c)
+	})
+
+	router.POST("/repost", func(c *gin.Context) {
+		acceptRepost(backend, resolvers, c)
+	})
+
+	router.POST("/edit", func(c *gin.Context) {
+		acceptEdit(backend, resolvers, previews, c)
+	})
+
+	router.POST("/delete", func(c *gin.Context) {
+		acceptDelete(backend, resolvers, c)
 	})
 
 	router.POST("/sign", func(c *gin.Context) {
 		sign(backend, c)
 	})
 
+	router.POST("/typeddata", typedData)
+
+	router.POST("/typeddata/hash", typedDataHash)
+
+	router.POST("/delegation/typeddata", delegationTypedData)
+
+	router.POST("/revoke", func(c *gin.Context) {
+		changeUser(backend, resolvers, c, "delegate", (*zebu.User).RevokeDelegate)
+	})
+
 	router.GET("/healthz", func(c *gin.Context) {
 		if !backend.Healthz(c.Request.Context()) {
 			errorPage(fmt.Errorf("ipfs isn't up"), c)
@@ -71,32 +108,88 @@ func serve(backend zebu.Backend) {
 	})
 
 	router.POST("/follow", func(c *gin.Context) {
-		acceptFollow(backend, c)
+		acceptFollow(backend, resolvers, c)
+	})
+
+	router.POST("/unfollow", func(c *gin.Context) {
+		changeUser(backend, resolvers, c, "followee", (*zebu.User).Unfollow)
+	})
+
+	router.POST("/mute", func(c *gin.Context) {
+		changeUser(backend, resolvers, c, "target", (*zebu.User).Mute)
+	})
+
+	router.POST("/unmute", func(c *gin.Context) {
+		changeUser(backend, resolvers, c, "target", (*zebu.User).Unmute)
+	})
+
+	router.POST("/block", func(c *gin.Context) {
+		changeUser(backend, resolvers, c, "target", (*zebu.User).Block)
+	})
+
+	router.POST("/unblock", func(c *gin.Context) {
+		changeUser(backend, resolvers, c, "target", (*zebu.User).Unblock)
+	})
+
+	router.GET("/follows", func(c *gin.Context) {
+		followspage(backend, resolvers, c)
 	})
 
 	router.POST("/register", func(c *gin.Context) {
-		registerDisplayName(backend, c)
+		registerDisplayName(backend, resolvers, c)
 	})
 
 	router.GET("/user/:id", func(c *gin.Context) {
-		userpage(backend, c)
+		userpage(backend, resolvers, avatars, c)
+	})
+	router.GET("/user/:id/forks", func(c *gin.Context) {
+		forkspage(backend, resolvers, c)
+	})
+	router.POST("/merge", func(c *gin.Context) {
+		acceptMerge(backend, resolvers, c)
+	})
+	router.POST("/profile", func(c *gin.Context) {
+		acceptProfile(backend, resolvers, c)
+	})
+	router.GET("/user/:id/history", func(c *gin.Context) {
+		historypage(backend, resolvers, c)
+	})
+	router.POST("/rollback", func(c *gin.Context) {
+		acceptRollback(backend, resolvers, c)
+	})
+	router.GET("/post/:cid", func(c *gin.Context) {
+		postpage(backend, resolvers, c)
+	})
+	router.GET("/post/:cid/thread", func(c *gin.Context) {
+		threadpage(backend, resolvers, index, c)
+	})
+	router.GET("/tag/:tag", func(c *gin.Context) {
+		tagpage(backend, resolvers, index, c)
+	})
+	router.GET("/notifications", func(c *gin.Context) {
+		notificationspage(backend, resolvers, index, c)
+	})
+	router.GET("/post/:cid/media", func(c *gin.Context) {
+		postMedia(backend, resolvers, c)
+	})
+	router.OPTIONS("/uploads", uploadOptions)
+	router.POST("/uploads", func(c *gin.Context) {
+		createUpload(backend, resolvers, uploads, c)
+	})
+	router.HEAD("/uploads/:id", func(c *gin.Context) {
+		uploadStatus(uploads, c)
+	})
+	router.PATCH("/uploads/:id", func(c *gin.Context) {
+		patchUpload(uploads, c)
+	})
+	router.DELETE("/uploads/:id", func(c *gin.Context) {
+		deleteUpload(uploads, c)
 	})
 	router.GET("/img/:cidr", func(c *gin.Context) {
-		cidr := c.Param("cidr")
-		imgreader, err := backend.Cat(c.Request.Context(), cidr)
-		if err != nil {
-			errorPage(err, c)
-			return
-		}
-		//can't get lenth without buf.
-		buf := &bytes.Buffer{}
-		_, err = buf.ReadFrom(imgreader)
-		if err != nil {
-			errorPage(err, c)
-			return
-		}
-
-		c.DataFromReader(http.StatusOK, int64(buf.Len()), "image/*", buf, map[string]string{})
+		media(backend, c)
+	})
+	router.GET("/media/:cidr", func(c *gin.Context) {
+		media(backend, c)
 	})
 
 	router.StaticFS("/static", loadStatic())
@@ -121,12 +214,17 @@ var defaultOffered = []string{"text/html", "application/json"}
 //https://go.dev/blog/pipelines
 //https://stackoverflow.com/questions/25142016/how-to-return-a-error-from-a-goroutine-through-channels
 
-func mergeUsers(ctx context.Context, backend zebu.Backend, users []string, count int) <-chan zebu.FetchedPost {
+//reader's mutes and blocks are applied so every feed honors them.
+func mergeUsers(ctx context.Context, backend zebu.Backend, resolvers *zebu.ResolverChain, reader zebu.User, users []string, count int) <-chan zebu.FetchedPost {
 	var allposts = make(chan zebu.FetchedPost)
 	var wg sync.WaitGroup
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	hide := newHider(resolvers, reader)
 	for _, u := range users {
+		if hide.hides(u) {
+			continue
+		}
 		wg.Add(1)
 		go func(user string) {
 			defer wg.Done()
@@ -135,11 +233,17 @@ func mergeUsers(ctx context.Context, backend zebu.Backend, users []string, count
 			if err != nil {
 				fallback := fmt.Sprintf("error getting user %s, %s", user, err)
 				log.Printf(fallback)
-				allposts <- zebu.FetchedPost{RenderedContent: template.HTML(fallback), Author: user, Post: zebu.Post{}}
+				allposts <- zebu.FetchedPost{RenderedContent: template.HTML(template.HTMLEscapeString(fallback)), Author: user, Post: zebu.Post{}}
+				return
+			}
+			if hide.hides(author.Name(), author.PublicKey()) {
 				return
 			}
 
-			for p := range userPosts(ctx, backend, author, count) {
+			for p := range userPosts(ctx, backend, resolvers, author, count) {
+				if hide.hidden(p) {
+					continue
+				}
 				allposts <- p
 			}
 
@@ -153,21 +257,74 @@ func mergeUsers(ctx context.Context, backend zebu.Backend, users []string, count
 	return allposts
 }
 
-func rand(backend zebu.Backend, c *gin.Context) {
-	users := backend.RandomUsers(3)
-	log.Printf("getting random users %v", users)
-	ctx := c.Request.Context()
-	randpostchan := mergeUsers(ctx, backend, users, 3)
+//hider is a reader's mutes and blocks resolved once per request. Posts name people by key in some places
+//(replies, reposts, notifications) and by name in others so both go in, lower cased since addresses come in either case.
+type hider struct {
+	muted, blocked map[string]bool
+}
 
-	randposts := lo.ChannelToSlice(randpostchan)
-	sortposts(randposts)
+func newHider(resolvers *zebu.ResolverChain, reader zebu.User) hider {
+	return hider{muted: resolveNames(resolvers, reader.Muted), blocked: resolveNames(resolvers, reader.Blocked)}
+}
+
+//a name we can't resolve right now still hides anything that uses the name.
+func resolveNames(resolvers *zebu.ResolverChain, names []string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range names {
+		set[strings.ToLower(name)] = true
+		key, err := resolvers.Resolve(name)
+		if err != nil {
+			log.Printf("couldn't resolve %s to hide them, %s", name, err)
+			continue
+		}
+		set[strings.ToLower(key)] = true
+	}
+	return set
+}
+
+func inSet(set map[string]bool, ids ...string) bool {
+	for _, id := range ids {
+		if id != "" && set[strings.ToLower(id)] {
+			return true
+		}
+	}
+	return false
+}
+
+func (h hider) blocks(ids ...string) bool {
+	return inSet(h.blocked, ids...)
+}
+
+func (h hider) hides(ids ...string) bool {
+	return h.blocks(ids...) || inSet(h.muted, ids...)
+}
+
+//mutes hide what someone posted or reposted. blocks also hide other people reposting or replying to them.
+func (h hider) hidden(p zebu.FetchedPost) bool {
+	if h.hides(p.Author, p.RepostedBy) {
+		return true
+	}
+	if p.InReplyTo != nil && h.blocks(p.InReplyTo.Author) {
+		return true
+	}
+	return p.RepostOf != nil && h.blocks(p.RepostOf.Author)
+}
 
+func rand(backend zebu.Backend, resolvers *zebu.ResolverChain, c *gin.Context) {
 	reader, err := reader(backend, c)
 	if err != nil {
 		errorPage(err, c)
 		return
 	}
 
+	users := backend.RandomUsers(3)
+	log.Printf("getting random users %v", users)
+	ctx := c.Request.Context()
+	randpostchan := mergeUsers(ctx, backend, resolvers, reader, users, 3)
+
+	randposts := lo.ChannelToSlice(randpostchan)
+	sortposts(randposts)
+
 	c.Negotiate(http.StatusOK, gin.Negotiate{
 		Offered: defaultOffered,
 		Data: gin.H{
@@ -178,22 +335,26 @@ func rand(backend zebu.Backend, c *gin.Context) {
 		HTMLName: "feed.tmpl"})
 }
 
-//sort by create time. users could lie abotu time but trust for now
+//sort by create time. users could lie abotu time so anything the chain validator flagged sinks below the rest.
 func sortposts(posts []zebu.FetchedPost) {
-	sort.Slice(posts, func(i, j int) bool {
+	sort.SliceStable(posts, func(i, j int) bool {
+		iclean, jclean := len(posts[i].Violations) == 0, len(posts[j].Violations) == 0
+		if iclean != jclean {
+			return iclean
+		}
 		return posts[i].Created.After(posts[j].Created)
 	})
 }
 
 //show what a user is following rahter than their posts.
-func userfeed(backend zebu.Backend, c *gin.Context, account string) {
+func userfeed(backend zebu.Backend, resolvers *zebu.ResolverChain, c *gin.Context, account string) {
 	ctx := c.Request.Context()
 	me, err := backend.GetUserById(ctx, account)
 	if err != nil {
 		errorPage(err, c)
 		return
 	}
-	followedpostschan := mergeUsers(ctx, backend, me.Follows, 3)
+	followedpostschan := mergeUsers(ctx, backend, resolvers, me, me.Follows, 3)
 
 	//show them random users if they have no one to follow? nah do this on html
 	followedposts := lo.ChannelToSlice(followedpostschan)
@@ -225,7 +386,7 @@ type simpleuser struct {
 	Id string `uri:"id" binding:"required"`
 }
 
-func userpage(backend zebu.Backend, c *gin.Context) {
+func userpage(backend zebu.Backend, resolvers *zebu.ResolverChain, avatars *zebu.Avatars, c *gin.Context) {
 	ctx := c.Request.Context()
 
 	//todo kill this silly type
@@ -245,7 +406,7 @@ func userpage(backend zebu.Backend, c *gin.Context) {
 	log.Printf("looking up %s", account)
 
 	//where is the best place to do this conistently.
-	account, err := zebu.Resolve(account)
+	account, err := resolvers.Resolve(account)
 	if err != nil {
 		errorPage(err, c)
 		return
@@ -258,8 +419,8 @@ func userpage(backend zebu.Backend, c *gin.Context) {
 	if err == nil {
 		log.Printf("seeing if %s is in %v", account, reader.Follows)
 		for _, f := range reader.Follows {
-			//too expensive for large number of followers? need to cache Resolve.
-			faccount, err := zebu.Resolve(f)
+			//Resolve caches so this is only slow the first time.
+			faccount, err := resolvers.Resolve(f)
 			if err == nil && faccount == account {
 				followed = true
 			}
@@ -272,12 +433,13 @@ func userpage(backend zebu.Backend, c *gin.Context) {
 		return
 	}
 
-	userposts := userPosts(ctx, backend, author, 10)
+	userposts := userPosts(ctx, backend, resolvers, author, 10)
 
 	c.Negotiate(http.StatusOK, gin.Negotiate{
 		Offered: defaultOffered,
 		Data: gin.H{
 			"Posts":     lo.ChannelToSlice(userposts),
+			"Profile":   describeProfile(ctx, backend, resolvers, avatars, author),
 			"Author":    author.Name(),
 			"AuthorKey": author.PublicKey(),
 			"Followed":  followed,
@@ -287,25 +449,16 @@ func userpage(backend zebu.Backend, c *gin.Context) {
 		HTMLName: "userpage.tmpl"})
 }
 
-func userPosts(ctx context.Context, backend zebu.Backend, user zebu.User, count int) <-chan zebu.FetchedPost {
+func userPosts(ctx context.Context, backend zebu.Backend, resolvers *zebu.ResolverChain, user zebu.User, count int) <-chan zebu.FetchedPost {
 
 	posts := backend.GetPosts(ctx, user, count)
 	var wg sync.WaitGroup
 	var userposts = make(chan zebu.FetchedPost, count)
 	for p := range posts {
 		wg.Add(1)
-		go func(p zebu.Post) {
+		go func(p zebu.FetchedPost) {
 			defer wg.Done()
-			content, err := zebu.CatString(ctx, backend, p.Content)
-			if err != nil {
-				content = fmt.Sprintf("error rendering post: %s %s", err.Error())
-			}
-
-			userposts <- zebu.FetchedPost{
-				Post:            p,
-				RenderedContent: template.HTML(content),
-				Author:          user.Name(),
-			}
+			userposts <- renderPost(ctx, backend, resolvers, withAuthor(resolvers, p, user))
 		}(p)
 	}
 	go func() {
@@ -316,6 +469,123 @@ func userPosts(ctx context.Context, backend zebu.Backend, user zebu.User, count
 	return userposts
 }
 
+//fills in content for a post we've already got and swaps in the original if its a repost.
+func renderPost(ctx context.Context, backend zebu.Backend, resolvers *zebu.ResolverChain, p zebu.FetchedPost) zebu.FetchedPost {
+	if p.RepostOf != nil {
+		p = fetchRepost(ctx, backend, resolvers, p)
+	}
+	if p.Deleted {
+		p.RenderedContent = "<em>deleted</em>"
+		return p
+	}
+	content, err := zebu.CatString(ctx, backend, p.Content)
+	if err != nil {
+		content = fmt.Sprintf("error rendering post %s: %s", p.CID, err.Error())
+	}
+	p.RenderedContent = zebu.Render(content)
+	if p.Preview != "" {
+		preview, err := zebu.GetPreview(ctx, backend, p.Preview)
+		if err != nil {
+			log.Printf("couldn't get preview %s of %s, %s", p.Preview, p.CID, err)
+		} else {
+			p.LinkPreview = &preview
+		}
+	}
+	return p
+}
+
+//fetches and renders a post we only have a reference to.
+func fetchPost(ctx context.Context, backend zebu.Backend, resolvers *zebu.ResolverChain, ref zebu.PostRef) (zebu.FetchedPost, error) {
+	author, err := backend.GetUserById(ctx, ref.Author)
+	if err != nil {
+		author = zebu.User{PublicName: ref.Author}
+	}
+	fetched, _, err := revisedPost(ctx, backend, author, ref.CID)
+	if err != nil {
+		return zebu.FetchedPost{}, err
+	}
+	return renderPost(ctx, backend, resolvers, withAuthor(resolvers, fetched, author)), nil
+}
+
+//revisedPost is cid with its author's edits and deletes applied. inchain is false if it isn't in their
+//recent chain, then there's nothing to apply and it's shown as it was posted.
+func revisedPost(ctx context.Context, backend zebu.ContentBackend, author zebu.User, cid string) (zebu.FetchedPost, bool, error) {
+	if revised, found := zebu.Revised(ctx, backend, author, cid, permalinkDepth); found {
+		return revised, true, nil
+	}
+	post, err := backend.GetPost(ctx, cid)
+	if err != nil {
+		return zebu.FetchedPost{}, false, err
+	}
+	return zebu.FetchedPost{Post: post, CID: cid, Signed: post.SignatureStatusFor(author)}, false, nil
+}
+
+//swap a repost for the original so it shows up under the original author.
+//if we can't find the original fall back to the copied content.
+func fetchRepost(ctx context.Context, backend zebu.Backend, resolvers *zebu.ResolverChain, repost zebu.FetchedPost) zebu.FetchedPost {
+	author, err := backend.GetUserById(ctx, repost.RepostOf.Author)
+	if err != nil {
+		author = zebu.User{PublicName: repost.RepostOf.Author}
+	}
+	//the reposters signature doesn't say anything about the original so it's checked on its own.
+	//if it isn't in their chain anyone could have written it so it stays the reposter's copy with a warning.
+	original, inchain, err := revisedPost(ctx, backend, author, repost.RepostOf.CID)
+	if err != nil || !inchain {
+		log.Printf("couldn't find reposted %s in %s's chain, %v", repost.RepostOf.CID, repost.RepostOf.Author, err)
+		repost.Unverified = true
+		return repost
+	}
+	original.RepostedBy = repost.Author
+	return withAuthor(resolvers, original, author)
+}
+
+//what a wallet needs to sign a record with eth_signTypedData_v4.
+func typedData(c *gin.Context) {
+	var unr zebu.UserNameRecord
+	if err := c.BindJSON(&unr); err != nil {
+		errorPage(err, c)
+		return
+	}
+	unr.Scheme = zebu.EIP712ChainScheme
+	c.JSON(200, typedDataJSON(unr.TypedData()))
+}
+
+//the same thing hashed for session keys to sign directly.
+func typedDataHash(c *gin.Context) {
+	var unr zebu.UserNameRecord
+	if err := c.BindJSON(&unr); err != nil {
+		errorPage(err, c)
+		return
+	}
+	unr.Scheme = zebu.EIP712ChainScheme
+	hash, err := unr.TypedDataHash()
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	c.JSON(200, gin.H{"Hash": hexutil.Encode(hash)})
+}
+
+//what the owner signs to hand a session key the ability to sign for them.
+func delegationTypedData(c *gin.Context) {
+	var d zebu.Delegation
+	if err := c.BindJSON(&d); err != nil {
+		errorPage(err, c)
+		return
+	}
+	c.JSON(200, typedDataJSON(d.TypedData()))
+}
+
+//metamask is picky about empty domain fields so only send what's set.
+func typedDataJSON(td apitypes.TypedData) gin.H {
+	return gin.H{
+		"types":       td.Types,
+		"primaryType": td.PrimaryType,
+		"domain":      td.Domain.Map(),
+		"message":     td.Message,
+	}
+}
+
 func sign(backend zebu.UserBackend, c *gin.Context) {
 	var unr zebu.UserNameRecord
 	err := c.BindJSON(&unr)
@@ -332,7 +602,7 @@ func sign(backend zebu.UserBackend, c *gin.Context) {
 	c.Status(200)
 }
 
-func acceptPost(backend zebu.Backend, c *gin.Context) {
+func acceptPost(backend zebu.Backend, resolvers *zebu.ResolverChain, uploads *zebu.Uploads, previews *zebu.PreviewFetcher, c *gin.Context) {
 	ctx := c.Request.Context()
 	form, err := c.MultipartForm()
 	if err != nil {
@@ -342,7 +612,7 @@ func acceptPost(backend zebu.Backend, c *gin.Context) {
 
 	log.Printf("got post %v", form)
 
-	user, err := zebu.Resolve(form.Value["account"][0])
+	user, err := resolvers.Resolve(form.Value["account"][0])
 	if err != nil {
 		errorPage(err, c)
 		return
@@ -353,54 +623,421 @@ func acceptPost(backend zebu.Backend, c *gin.Context) {
 		return
 	}
 
-	images := form.File["images"]
-	imagecidrs := []string{}
-	for _, img := range images {
-		log.Printf("found %s", img.Filename)
-		f, err := img.Open()
+	attachments, err := saveImages(ctx, backend, form)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	uploaded, err := attachUploads(ctx, backend, uploads, user, form.Value)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	attachments = append(attachments, uploaded...)
+
+	posttext := form.Value["post"][0]
+	mentions, err := zebu.ResolveMentions(zebu.ExtractMentions(posttext), resolvers.Resolve)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+
+	cid, err := zebu.AddString(ctx, backend, posttext)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+
+	post := zebu.Post{
+		Content:     cid,
+		Created:     time.Now().UTC(),
+		Attachments: attachments,
+		Tags:        zebu.ExtractTags(posttext),
+		Mentions:    mentions,
+		Preview:     linkPreview(ctx, backend, previews, posttext),
+	}
+	if replyto := form.Value["replyto"]; len(replyto) > 0 && replyto[0] != "" {
+		replytoauthor := form.Value["replytoauthor"]
+		if len(replytoauthor) == 0 {
+			errorPage(fmt.Errorf("need replytoauthor with replyto"), c)
+			return
+		}
+		//author is usually a display name so pin down the key.
+		authorkey, err := resolvers.Resolve(replytoauthor[0])
 		if err != nil {
 			errorPage(err, c)
 			return
 		}
-		cidr, err := backend.Add(ctx, f)
+		post.InReplyTo = &zebu.PostRef{CID: replyto[0], Author: authorkey}
+	}
+	unsignedPost(poster, post, c)
+}
+
+const (
+	//alt text is for describing an image not writing a second post.
+	maxAlt = 1500 //characters
+	//images get decoded in memory. Anything bigger should be a video.
+	maxImageUpload = 50 << 20
+)
+
+func altText(alt string) (string, error) {
+	alt = strings.TrimSpace(alt)
+	if utf8.RuneCountInString(alt) > maxAlt {
+		return "", fmt.Errorf("alt text is longer than %d characters", maxAlt)
+	}
+	return alt, nil
+}
+
+//saveImages strips metadata from uploads and saves them with their thumbnails.
+//alt fields line up with images, the nth alt describes the nth file.
+func saveImages(ctx context.Context, backend zebu.ContentBackend, form *multipart.Form) ([]zebu.Attachment, error) {
+	attachments := []zebu.Attachment{}
+	alts := form.Value["alt"]
+	for i, img := range form.File["images"] {
+		//an empty file input still sends an empty file.
+		if img.Size == 0 && img.Filename == "" {
+			continue
+		}
+		log.Printf("found %s", img.Filename)
+		f, err := img.Open()
+		if err != nil {
+			return nil, err
+		}
+		saved, err := zebu.SaveImage(ctx, backend, f)
+		f.Close()
 		if err != nil {
+			return nil, fmt.Errorf("couldn't save %s, %w", img.Filename, err)
+		}
+		if i < len(alts) {
+			if saved.Alt, err = altText(alts[i]); err != nil {
+				return nil, fmt.Errorf("%s, %w", img.Filename, err)
+			}
+		}
+		log.Printf("saved %s as %s", img.Filename, saved.CID)
+		attachments = append(attachments, saved)
+	}
+	return attachments, nil
+}
+
+//linkPreview saves a preview of the first link in text. Sites go down and turn away bots all the time
+//which isn't worth failing a post over so it's just no preview.
+func linkPreview(ctx context.Context, backend zebu.ContentBackend, previews *zebu.PreviewFetcher, text string) string {
+	link := zebu.FirstLink(text)
+	if link == "" {
+		return ""
+	}
+	cid, err := previews.Preview(ctx, backend, link)
+	if err != nil {
+		log.Printf("no preview for %s, %s", link, err)
+		return ""
+	}
+	return cid
+}
+
+//chains post onto the posters history and returns the record they need to sign.
+func appendPost(ctx context.Context, backend zebu.Backend, poster zebu.User, post zebu.Post) (zebu.UserNameRecord, error) {
+	return savePost(ctx, backend, poster, chainPost(poster, post))
+}
+
+//chainPost fills in where post goes in poster's chain. Everything a signature covers has to be set before signing.
+func chainPost(poster zebu.User, post zebu.Post) zebu.Post {
+	post.Previous = poster.LastPost
+	post.Author = poster.Name()
+	if len(post.Attachments) > 0 {
+		post.Images = lo.Map(post.Attachments, func(a zebu.Attachment, _ int) string { return a.CID })
+	}
+	return post
+}
+
+func savePost(ctx context.Context, backend zebu.Backend, poster zebu.User, post zebu.Post) (zebu.UserNameRecord, error) {
+	postcidr, err := backend.SavePost(ctx, post)
+	if err != nil {
+		return zebu.UserNameRecord{}, err
+	}
+	poster.LastPost = postcidr
+	return backend.SaveUserCid(ctx, poster)
+}
+
+//unsignedPost sends post back for poster to sign and hand to /publish. A session's delegation goes in
+//first since the signature covers it.
+func unsignedPost(poster zebu.User, post zebu.Post, c *gin.Context) {
+	post = chainPost(poster, post)
+	if delegation := c.PostForm("delegation"); delegation != "" {
+		var d zebu.Delegation
+		if err := json.Unmarshal([]byte(delegation), &d); err != nil {
 			errorPage(err, c)
 			return
 		}
-		log.Printf("saved %s as %s", img.Filename, cidr)
-		imagecidrs = append(imagecidrs, cidr)
+		post.Delegation = &d
 	}
+	c.JSON(200, post)
+}
 
-	posttext := form.Value["post"][0]
+//publishPost takes a post from unsignedPost back with its signature, checks it and chains it on.
+func publishPost(backend zebu.Backend, resolvers *zebu.ResolverChain, c *gin.Context) {
+	ctx := c.Request.Context()
+	account, faccount := c.GetPostForm("account")
+	postjson, fpost := c.GetPostForm("post")
+	if !faccount || !fpost {
+		errorPage(fmt.Errorf("need account and post"), c)
+		return
+	}
+	account, err := resolvers.Resolve(account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	poster, err := backend.GetUserById(ctx, account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	var post zebu.Post
+	if err := json.Unmarshal([]byte(postjson), &post); err != nil {
+		errorPage(err, c)
+		return
+	}
+	//they posted something else in between so this one points at the wrong place.
+	if post.Previous != poster.LastPost {
+		errorPage(fmt.Errorf("%s has posted since this was signed, try again", poster.Name()), c)
+		return
+	}
+	if err := checkPublishTime(poster, post, time.Now()); err != nil {
+		errorPage(err, c)
+		return
+	}
+	if err := checkPostRefs(ctx, backend, poster, post); err != nil {
+		errorPage(err, c)
+		return
+	}
+	if status := post.SignatureStatusFor(poster); status != zebu.SignatureValid {
+		errorPage(fmt.Errorf("post signature is %s", status), c)
+		return
+	}
+	//a session scoped to posts can't touch the rest of the profile so the profile skips a deleted pin instead.
+	if post.Kind == zebu.DeletePost && poster.PinnedPost == post.Target && post.Delegation == nil {
+		poster.PinnedPost = ""
+	}
+	record, err := savePost(ctx, backend, poster, post)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	c.JSON(200, record)
+}
 
-	cid, err := zebu.AddString(ctx, backend, posttext)
+//checkPublishTime holds a new post to now. SignatureStatusFor checks delegations against Created
+//so old posts still read, which would let a backdated post from an expired or revoked session through.
+func checkPublishTime(poster zebu.User, post zebu.Post, now time.Time) error {
+	if post.Created.Before(now.Add(-zebu.ClockSkew)) || post.Created.After(now.Add(zebu.ClockSkew)) {
+		return fmt.Errorf("post was created at %s, sign it again", post.Created)
+	}
+	if post.Delegation != nil {
+		if err := post.Delegation.Check(poster.PublicKey(), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func acceptRepost(backend zebu.Backend, resolvers *zebu.ResolverChain, c *gin.Context) {
+	ctx := c.Request.Context()
+	account, faccount := c.GetPostForm("account")
+	repostcid, fcid := c.GetPostForm("repost")
+	author, fauthor := c.GetPostForm("author")
+	if !faccount || !fcid || !fauthor {
+		errorPage(fmt.Errorf("need account, repost and author"), c)
+		return
+	}
+	log.Printf("got repost %s %s", account, repostcid)
+	account, err := resolvers.Resolve(account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	poster, err := backend.GetUserById(ctx, account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+
+	//author is usually a display name so pin down the key.
+	authorkey, err := resolvers.Resolve(author)
 	if err != nil {
 		errorPage(err, c)
 		return
 	}
+	original, err := backend.GetPost(ctx, repostcid)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	//reposting a repost just reposts the original.
+	ref := &zebu.PostRef{CID: repostcid, Author: authorkey}
+	if original.RepostOf != nil {
+		ref = original.RepostOf
+	}
 
 	post := zebu.Post{
-		Previous: poster.LastPost,
-		Content:  cid,
-		Created:  time.Now().UTC(),
-		Images:   imagecidrs,
-		Author:   poster.Name(),
+		Content:     original.Content,
+		Images:      original.Images,
+		Attachments: original.Attachments,
+		Preview:     original.Preview,
+		Created:     time.Now().UTC(),
+		RepostOf:    ref,
 	}
-	postcidr, err := backend.SavePost(ctx, post)
+	if err := checkPostRefs(ctx, backend, poster, post); err != nil {
+		errorPage(err, c)
+		return
+	}
+	unsignedPost(poster, post, c)
+}
+
+//finds the post an edit or delete should point at and makes sure it belongs to poster.
+func revisionTarget(ctx context.Context, backend zebu.Backend, poster zebu.User, target string) (zebu.Post, string, error) {
+	post, err := backend.GetPost(ctx, target)
+	if err != nil {
+		return post, target, err
+	}
+	//editing an edit edits the original.
+	if post.Kind == zebu.EditPost {
+		target = post.Target
+		if post, err = backend.GetPost(ctx, target); err != nil {
+			return post, target, err
+		}
+	}
+	if post.IsTombstone() {
+		return post, target, fmt.Errorf("can't revise a %s", post.Kind)
+	}
+	if !zebu.InChain(ctx, backend, poster, target, permalinkDepth) {
+		return post, target, fmt.Errorf("%s isn't one of %s's posts", target, poster.Name())
+	}
+	return post, target, nil
+}
+
+//checkPostRefs makes sure the posts post points at are what it says. Signing only proves poster
+//made the post so /repost and /publish both check before anything is saved.
+func checkPostRefs(ctx context.Context, backend zebu.Backend, poster zebu.User, post zebu.Post) error {
+	switch post.Kind {
+	case "":
+	case zebu.EditPost, zebu.DeletePost:
+		_, target, err := revisionTarget(ctx, backend, poster, post.Target)
+		if err != nil {
+			return err
+		}
+		if target != post.Target {
+			return fmt.Errorf("%s should point at the original %s", post.Kind, target)
+		}
+	default:
+		return fmt.Errorf("can't publish a %s post", post.Kind)
+	}
+	if post.RepostOf != nil {
+		//anyone can claim anyone wrote a cid so make sure it's really theirs before it's saved under their name.
+		owner, err := backend.GetUserById(ctx, post.RepostOf.Author)
+		if err != nil {
+			return err
+		}
+		if !zebu.InChain(ctx, backend, owner, post.RepostOf.CID, permalinkDepth) {
+			return fmt.Errorf("%s isn't one of %s's posts", post.RepostOf.CID, owner.Name())
+		}
+	}
+	return nil
+}
+
+func acceptEdit(backend zebu.Backend, resolvers *zebu.ResolverChain, previews *zebu.PreviewFetcher, c *gin.Context) {
+	ctx := c.Request.Context()
+	form, err := c.MultipartForm()
 	if err != nil {
 		errorPage(err, c)
 		return
 	}
-	poster.LastPost = postcidr
-	posterrecord, err := backend.SaveUserCid(ctx, poster)
+	if len(form.Value["account"]) == 0 || len(form.Value["target"]) == 0 || len(form.Value["post"]) == 0 {
+		errorPage(fmt.Errorf("need account, target and post"), c)
+		return
+	}
+	account, err := resolvers.Resolve(form.Value["account"][0])
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	poster, err := backend.GetUserById(ctx, account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	original, target, err := revisionTarget(ctx, backend, poster, form.Value["target"][0])
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+
+	attachments, err := saveImages(ctx, backend, form)
 	if err != nil {
 		errorPage(err, c)
 		return
 	}
-	c.JSON(200, posterrecord)
+	//no new images means keep the old ones. Legacy posts only have Images.
+	if len(attachments) == 0 {
+		attachments = original.Attachments
+	}
+	mentions, err := zebu.ResolveMentions(zebu.ExtractMentions(form.Value["post"][0]), resolvers.Resolve)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	cid, err := zebu.AddString(ctx, backend, form.Value["post"][0])
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+
+	edit := zebu.Post{
+		Kind:        zebu.EditPost,
+		Target:      target,
+		Content:     cid,
+		Images:      original.Images, //replaced by chainPost if there are attachments
+		Attachments: attachments,
+		Tags:        zebu.ExtractTags(form.Value["post"][0]),
+		Mentions:    mentions,
+		Preview:     linkPreview(ctx, backend, previews, form.Value["post"][0]),
+		Created:     time.Now().UTC(),
+	}
+	unsignedPost(poster, edit, c)
 }
 
-func acceptFollow(backend zebu.UserBackend, c *gin.Context) {
+func acceptDelete(backend zebu.Backend, resolvers *zebu.ResolverChain, c *gin.Context) {
+	ctx := c.Request.Context()
+	account, faccount := c.GetPostForm("account")
+	target, ftarget := c.GetPostForm("target")
+	if !faccount || !ftarget {
+		errorPage(fmt.Errorf("need account and target"), c)
+		return
+	}
+	account, err := resolvers.Resolve(account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	poster, err := backend.GetUserById(ctx, account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	_, target, err = revisionTarget(ctx, backend, poster, target)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+
+	tombstone := zebu.Post{
+		Kind:    zebu.DeletePost,
+		Target:  target,
+		Created: time.Now().UTC(),
+	}
+	unsignedPost(poster, tombstone, c)
+}
+
+func acceptFollow(backend zebu.UserBackend, resolvers *zebu.ResolverChain, c *gin.Context) {
 	ctx := c.Request.Context()
 	account, faccount := c.GetPostForm("account")
 	followee, ff := c.GetPostForm("followee")
@@ -408,7 +1045,7 @@ func acceptFollow(backend zebu.UserBackend, c *gin.Context) {
 		errorPage(fmt.Errorf("need account and followee"), c)
 	}
 	log.Printf("got follow %s %s", account, followee)
-	account, err := zebu.Resolve(account)
+	account, err := resolvers.Resolve(account)
 	if err != nil {
 		errorPage(err, c)
 		return
@@ -420,7 +1057,7 @@ func acceptFollow(backend zebu.UserBackend, c *gin.Context) {
 	}
 
 	//resolve folowee so we don't add garbage?
-	_, err = zebu.Resolve(account)
+	_, err = resolvers.Resolve(account)
 	if err != nil {
 		errorPage(err, c)
 		return
@@ -435,7 +1072,37 @@ func acceptFollow(backend zebu.UserBackend, c *gin.Context) {
 	c.JSON(200, followrecord)
 }
 
-func registerDisplayName(backend zebu.Backend, c *gin.Context) {
+//shared by unfollow, mute and block. They all take someone from field and change the account's lists.
+func changeUser(backend zebu.UserBackend, resolvers *zebu.ResolverChain, c *gin.Context, field string, change func(*zebu.User, string)) {
+	ctx := c.Request.Context()
+	account, faccount := c.GetPostForm("account")
+	target, ftarget := c.GetPostForm(field)
+	if !faccount || !ftarget {
+		errorPage(fmt.Errorf("need account and %s", field), c)
+		return
+	}
+	log.Printf("got %s %s %s", c.FullPath(), account, target)
+	account, err := resolvers.Resolve(account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	user, err := backend.GetUserById(ctx, account)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	change(&user, strings.TrimSpace(target))
+
+	record, err := backend.SaveUserCid(ctx, user)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	c.JSON(200, record)
+}
+
+func registerDisplayName(backend zebu.Backend, resolvers *zebu.ResolverChain, c *gin.Context) {
 	ctx := c.Request.Context()
 	account, faccount := c.GetPostForm("account")
 	displayname, ff := c.GetPostForm("register")
@@ -449,7 +1116,7 @@ func registerDisplayName(backend zebu.Backend, c *gin.Context) {
 		return
 	}
 
-	currentaddress, err := zebu.Resolve(displayname)
+	currentaddress, err := resolvers.Resolve(displayname)
 	if err != nil && err != zebu.DNSNotFound {
 		errorPage(err, c)
 		return
@@ -468,7 +1135,7 @@ func registerDisplayName(backend zebu.Backend, c *gin.Context) {
 	displayname = strings.TrimSpace(displayname)
 	log.Printf("regisering %s->%s", account, displayname)
 	//validate valida dns host? https://kubernetes.io/docs/concepts/overview/working-with-objects/names/#dns-subdomain-names rfc 1123
-	displayname, err = zebu.RegisterDNS(displayname, account)
+	displayname, err = resolvers.Register(displayname, account)
 	if err != nil {
 
 		errorPage(err, c)
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"paulgmiller/zebu/zebu"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+)
+
+func TestHider(t *testing.T) {
+	spammer := "0x5AEDA56215b167893e80B4fE645BA6d5Bab767DE"
+	troll := "0x000000000000000000000000000000000000bad1"
+	aliases := zebu.NewAliasResolver(map[string]string{"spammer": spammer, "troll.northbriton.net": troll})
+	resolvers := zebu.NewResolverChain(zebu.KeyResolver{}, aliases)
+	reader := zebu.User{Muted: []string{"Spammer"}, Blocked: []string{"troll.northbriton.net", "nobody.eth"}}
+	hide := newHider(resolvers, reader)
+
+	cases := []struct {
+		name   string
+		post   zebu.FetchedPost
+		hidden bool
+	}{
+		{"muted by name", zebu.FetchedPost{Author: "spammer"}, true},
+		{"muted by key in another case", zebu.FetchedPost{Author: "0x5aeda56215b167893e80b4fe645ba6d5bab767de"}, true},
+		{"reposted by someone muted", zebu.FetchedPost{Author: "alice", RepostedBy: spammer}, true},
+		{"replying to someone muted", zebu.FetchedPost{Author: "alice", Post: zebu.Post{InReplyTo: &zebu.PostRef{Author: spammer}}}, false},
+		{"replying to someone blocked", zebu.FetchedPost{Author: "alice", Post: zebu.Post{InReplyTo: &zebu.PostRef{Author: troll}}}, true},
+		{"repost of someone blocked", zebu.FetchedPost{Author: "alice", Post: zebu.Post{RepostOf: &zebu.PostRef{Author: troll}}}, true},
+		{"unresolvable names still match themselves", zebu.FetchedPost{Author: "nobody.eth"}, true},
+		{"someone else", zebu.FetchedPost{Author: "alice"}, false},
+	}
+	for _, c := range cases {
+		if got := hide.hidden(c.post); got != c.hidden {
+			t.Errorf("%s: hidden %v", c.name, got)
+		}
+	}
+}
+
+//chainBackend knows some posts and whose chain each is in, newest first. Anything else panics.
+type chainBackend struct {
+	zebu.Backend
+	posts  map[string]zebu.Post
+	chains map[string][]string
+}
+
+func (b *chainBackend) GetPost(ctx context.Context, cid string) (zebu.Post, error) {
+	post, found := b.posts[cid]
+	if !found {
+		return post, fmt.Errorf("%s not found", cid)
+	}
+	return post, nil
+}
+
+func (b *chainBackend) GetUserById(ctx context.Context, id string) (zebu.User, error) {
+	user := zebu.User{PublicName: id}
+	if chain := b.chains[id]; len(chain) > 0 {
+		user.LastPost = chain[0]
+	}
+	return user, nil
+}
+
+func (b *chainBackend) GetPosts(ctx context.Context, user zebu.User, count int) <-chan zebu.FetchedPost {
+	posts := make(chan zebu.FetchedPost, len(b.chains[user.PublicName]))
+	for _, cid := range b.chains[user.PublicName] {
+		posts <- zebu.FetchedPost{Post: b.posts[cid], CID: cid}
+	}
+	close(posts)
+	return posts
+}
+
+func TestAcceptRepost(t *testing.T) {
+	alice := "0x5AEDA56215b167893e80B4fE645BA6d5Bab767DE"
+	bob := "0x000000000000000000000000000000000000b0b1"
+	mallory := "0x000000000000000000000000000000000000bad1"
+	const (
+		aliceCID   = "QmZTR5bcpQD7cFgTorqxZDYaew1Wqgfbd2ud9QqGPAkK2V"
+		bobRepost  = "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"
+		fakeRepost = "QmTkzDwWqPbnAh5YiV5VwcTLnGdwSNsNTn2aDxdXBFca7D"
+	)
+	backend := &chainBackend{
+		posts: map[string]zebu.Post{
+			aliceCID:   {Content: "QmAlice"},
+			bobRepost:  {Content: "QmAlice", RepostOf: &zebu.PostRef{CID: aliceCID, Author: alice}},
+			fakeRepost: {Content: "QmMallory", RepostOf: &zebu.PostRef{CID: fakeRepost, Author: alice}},
+		},
+		chains: map[string][]string{alice: {aliceCID}, bob: {bobRepost}, mallory: {fakeRepost}},
+	}
+	router := gin.New()
+	router.POST("/repost", func(c *gin.Context) { acceptRepost(backend, zebu.NewResolverChain(zebu.KeyResolver{}), c) })
+	repost := func(cid, author string) *httptest.ResponseRecorder {
+		form := url.Values{"account": {mallory}, "repost": {cid}, "author": {author}}
+		req := httptest.NewRequest(http.MethodPost, "/repost", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	cases := []struct {
+		name   string
+		cid    string
+		author string
+		ok     bool
+	}{
+		{"alice's own post", aliceCID, alice, true},
+		{"bob's repost of alice", bobRepost, bob, true},
+		{"a repost goes to the original whoever it's claimed to be by", bobRepost, alice, true},
+		{"claiming alice wrote someone else's post", aliceCID, bob, false},
+		{"a repost that lies about alice", fakeRepost, mallory, false},
+	}
+	for _, c := range cases {
+		w := repost(c.cid, c.author)
+		if (w.Code == http.StatusOK) != c.ok {
+			t.Errorf("%s: got %d %s", c.name, w.Code, w.Body.String())
+			continue
+		}
+		if !c.ok {
+			continue
+		}
+		var post zebu.Post
+		if err := json.Unmarshal(w.Body.Bytes(), &post); err != nil {
+			t.Fatal(err)
+		}
+		if post.RepostOf == nil || post.RepostOf.CID != aliceCID || post.RepostOf.Author != alice {
+			t.Errorf("%s: should repost alice's original got %+v", c.name, post.RepostOf)
+		}
+	}
+}
+
+func TestCheckPublishTime(t *testing.T) {
+	master, _ := crypto.GenerateKey()
+	session, _ := crypto.GenerateKey()
+	poster := zebu.User{PublicName: crypto.PubkeyToAddress(master.PublicKey).Hex()}
+	now := time.Now()
+	expired, err := zebu.NewDelegation(master, crypto.PubkeyToAddress(session.PublicKey).Hex(), now.Add(-time.Hour), zebu.ScopePosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := zebu.NewDelegation(master, crypto.PubkeyToAddress(session.PublicKey).Hex(), now.Add(time.Hour), zebu.ScopePosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//backdated to when the session was good its signature still reads fine, publishing is what stops it.
+	backdated := zebu.Post{Content: "QmLeaked", Created: now.Add(-2 * time.Hour), Delegation: &expired}
+	if err := backdated.Sign(session); err != nil {
+		t.Fatal(err)
+	}
+	if status := backdated.SignatureStatusFor(poster); status != zebu.SignatureValid {
+		t.Fatalf("old posts from an expired session should still read got %s", status)
+	}
+
+	cases := []struct {
+		name string
+		post zebu.Post
+		ok   bool
+	}{
+		{"backdated by an expired session", backdated, false},
+		{"now by an expired session", zebu.Post{Created: now, Delegation: &expired}, false},
+		{"now by a current session", zebu.Post{Created: now, Delegation: &current}, true},
+		{"now by the owner", zebu.Post{Created: now}, true},
+		{"backdated by the owner", zebu.Post{Created: now.Add(-time.Hour)}, false},
+		{"from the future", zebu.Post{Created: now.Add(time.Hour)}, false},
+	}
+	for _, c := range cases {
+		if err := checkPublishTime(poster, c.post, now); (err == nil) != c.ok {
+			t.Errorf("%s: got %v", c.name, err)
+		}
+	}
+}
+
+func TestCheckPostRefs(t *testing.T) {
+	alice := "0x5AEDA56215b167893e80B4fE645BA6d5Bab767DE"
+	mallory := "0x000000000000000000000000000000000000bad1"
+	const (
+		aliceCID = "QmZTR5bcpQD7cFgTorqxZDYaew1Wqgfbd2ud9QqGPAkK2V"
+		editCID  = "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"
+	)
+	backend := &chainBackend{
+		posts: map[string]zebu.Post{
+			aliceCID: {Content: "QmAlice"},
+			editCID:  {Kind: zebu.EditPost, Target: aliceCID, Content: "QmEdited"},
+		},
+		chains: map[string][]string{alice: {editCID, aliceCID}},
+	}
+	cases := []struct {
+		name   string
+		poster string
+		post   zebu.Post
+		ok     bool
+	}{
+		{"a plain post", mallory, zebu.Post{Content: "QmHello"}, true},
+		{"reposting alice", mallory, zebu.Post{RepostOf: &zebu.PostRef{CID: aliceCID, Author: alice}}, true},
+		{"reposting something alice never posted", mallory, zebu.Post{RepostOf: &zebu.PostRef{CID: "QmMallory", Author: alice}}, false},
+		{"alice editing her post", alice, zebu.Post{Kind: zebu.EditPost, Target: aliceCID}, true},
+		{"alice deleting her post", alice, zebu.Post{Kind: zebu.DeletePost, Target: aliceCID}, true},
+		{"alice editing her edit", alice, zebu.Post{Kind: zebu.EditPost, Target: editCID}, false},
+		{"mallory deleting alice's post", mallory, zebu.Post{Kind: zebu.DeletePost, Target: aliceCID}, false},
+		{"merges are only made by the server", alice, zebu.Post{Kind: zebu.MergePost, Target: aliceCID}, false},
+	}
+	for _, c := range cases {
+		err := checkPostRefs(context.Background(), backend, zebu.User{PublicName: c.poster}, c.post)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: got %v", c.name, err)
+		}
+	}
+}
+
+func TestFetchRepost(t *testing.T) {
+	alice := "0x5AEDA56215b167893e80B4fE645BA6d5Bab767DE"
+	mallory := "0x000000000000000000000000000000000000bad1"
+	const aliceCID = "QmZTR5bcpQD7cFgTorqxZDYaew1Wqgfbd2ud9QqGPAkK2V"
+	backend := &chainBackend{
+		posts:  map[string]zebu.Post{aliceCID: {Content: "QmAlice"}, "QmMallory": {Content: "QmLies"}},
+		chains: map[string][]string{alice: {aliceCID}},
+	}
+	resolvers := zebu.NewResolverChain(zebu.KeyResolver{})
+
+	real := fetchRepost(context.Background(), backend, resolvers, zebu.FetchedPost{Author: mallory, Post: zebu.Post{Content: "QmAlice", RepostOf: &zebu.PostRef{CID: aliceCID, Author: alice}}})
+	if real.Author != alice || real.RepostedBy != mallory || real.Unverified {
+		t.Fatalf("expected alice's post reposted by mallory got %+v", real)
+	}
+	fake := fetchRepost(context.Background(), backend, resolvers, zebu.FetchedPost{Author: mallory, Post: zebu.Post{Content: "QmLies", RepostOf: &zebu.PostRef{CID: "QmMallory", Author: alice}}})
+	if fake.Author != mallory || fake.RepostedBy != "" || !fake.Unverified {
+		t.Fatalf("a repost alice never posted shouldn't be hers got %+v", fake)
+	}
+}
+
+func TestAcceptDeleteIsUnsigned(t *testing.T) {
+	alice := "0x5AEDA56215b167893e80B4fE645BA6d5Bab767DE"
+	const aliceCID = "QmZTR5bcpQD7cFgTorqxZDYaew1Wqgfbd2ud9QqGPAkK2V"
+	backend := &chainBackend{
+		posts:  map[string]zebu.Post{aliceCID: {Content: "QmAlice"}},
+		chains: map[string][]string{alice: {aliceCID}},
+	}
+	router := gin.New()
+	router.POST("/delete", func(c *gin.Context) { acceptDelete(backend, zebu.NewResolverChain(zebu.KeyResolver{}), c) })
+	form := url.Values{"account": {alice}, "target": {aliceCID}}
+	req := httptest.NewRequest(http.MethodPost, "/delete", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	//nothing's saved until alice signs it and hands it to /publish.
+	var tombstone zebu.Post
+	if err := json.Unmarshal(w.Body.Bytes(), &tombstone); err != nil {
+		t.Fatal(err)
+	}
+	if tombstone.Kind != zebu.DeletePost || tombstone.Target != aliceCID || tombstone.Previous != aliceCID || tombstone.Signature != "" {
+		t.Fatalf("expected an unsigned tombstone for alice to sign got %+v", tombstone)
+	}
+}
+
+//what zebu.js does with a session, sign the hash the server hands back as is.
+func TestSessionSignsChainedRecord(t *testing.T) {
+	master, _ := crypto.GenerateKey()
+	session, _ := crypto.GenerateKey()
+	d, err := zebu.NewDelegation(master, crypto.PubkeyToAddress(session.PublicKey).Hex(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unr := zebu.UserNameRecord{
+		CID:      "QmNew",
+		Sequence: 3,
+		PubKey:   d.Owner,
+		Previous: "QmOld",
+		Merged:   "QmFork",
+	}
+	body, _ := json.Marshal(unr)
+	router := gin.New()
+	router.POST("/typeddata/hash", typedDataHash)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/typeddata/hash", strings.NewReader(string(body))))
+	var hashed struct{ Hash string }
+	if err := json.Unmarshal(w.Body.Bytes(), &hashed); err != nil {
+		t.Fatalf("%d %s, %v", w.Code, w.Body.String(), err)
+	}
+	hash, err := hexutil.Decode(hashed.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(hash, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+
+	unr.Scheme = zebu.EIP712ChainScheme
+	unr.Signature = hexutil.Encode(sig)
+	unr.Delegation = &d
+	if !unr.Validate() {
+		t.Fatalf("session signed record didn't validate")
+	}
+	unr.Previous = "QmSomethingElse"
+	if unr.Validate() {
+		t.Fatalf("Previous should be covered by the session's signature")
+	}
+}
@@ -0,0 +1,354 @@
+// shared between templates. expects account and accountKey to be set by the page.
+window.w3 = new Web3(window.ethereum)
+
+// session keys live in localStorage so the wallet only gets asked once.
+const sessionStorageKey = () => "zebu_session_" + accountKey
+
+const loadSession = () => {
+	var session = JSON.parse(localStorage.getItem(sessionStorageKey()) || "null")
+	if (!session) {
+		return null
+	}
+	if (session.delegation.Expires && session.delegation.Expires * 1000 < Date.now()) {
+		localStorage.removeItem(sessionStorageKey())
+		return null
+	}
+	return session
+}
+
+// asks the wallet to delegate to a fresh local key. scopes can be "posts" and/or "follows", empty means everything.
+const startSession = async (hours, scopes) => {
+	var key = w3.eth.accounts.create()
+	var delegation = {
+		Owner: accountKey,
+		Delegate: key.address,
+		Expires: Math.floor(Date.now() / 1000) + hours * 3600,
+		Scopes: scopes,
+	}
+	var response = await fetch("/delegation/typeddata", { method: "POST", body: JSON.stringify(delegation) })
+	var typed = await response.json()
+	delegation.Signature = await window.ethereum.request({
+		method: "eth_signTypedData_v4",
+		params: [accountKey, JSON.stringify(typed)],
+	})
+	localStorage.setItem(sessionStorageKey(), JSON.stringify({ privateKey: key.privateKey, delegation: delegation }))
+	location.reload()
+}
+
+// forgets the session key and revokes it so a leaked copy is useless.
+const endSession = async () => {
+	var session = loadSession()
+	localStorage.removeItem(sessionStorageKey())
+	if (session) {
+		var formData = new FormData()
+		formData.append("delegate", session.delegation.Delegate)
+		await postAndSign("/revoke", formData, true)
+	}
+	location.reload()
+}
+
+// web3's accounts.sign always hashes with the personal_sign prefix first, swapping that
+// hash for one that does nothing signs digest itself.
+const signDigest = (digest, privateKey) => {
+	var raw = Object.create(w3.eth.accounts)
+	raw.hashMessage = (hash) => hash
+	return w3.eth.accounts.sign.call(raw, digest, privateKey).signature
+}
+
+// signs a UserNameRecord as EIP-712 typed data the server builds so the types only live in one place.
+// With a session the local key signs it, otherwise the wallet does.
+const signRecord = async (data, master) => {
+	var session = master ? null : loadSession()
+	if (session) {
+		// same chained scheme as the wallet so Previous and Merged are signed too.
+		// there's no wallet to do the typed data so the server hashes it and the session key signs that.
+		var hashed = await fetch("/typeddata/hash", { method: "POST", body: JSON.stringify(data) })
+		data.Scheme = "eip712-v2"
+		data.Signature = signDigest((await hashed.json()).Hash, session.privateKey)
+		data.Delegation = session.delegation
+		return data
+	}
+	var response = await fetch("/typeddata", { method: "POST", body: JSON.stringify(data) })
+	var typed = await response.json()
+	data.Scheme = "eip712-v2"
+	data.Signature = await window.ethereum.request({
+		method: "eth_signTypedData_v4",
+		params: [accountKey, JSON.stringify(typed)],
+	})
+	return data
+}
+
+// posts a form that comes back with a UserNameRecord, signs it and publishes it.
+// master forces the wallet even if there's a session for things delegates can't do.
+const postAndSign = async (url, formData, master) => {
+	formData.append("account", account)
+	console.log(formData)
+	var response = await fetch(url, { method: "POST", body: formData }  )
+	//error if data already has signature?
+	var data = await signRecord(await response.json(), master)
+	console.log(data)
+	response = await fetch("/sign", { method: "POST", body: JSON.stringify(data)}  )
+	console.log(response)
+	return response
+}
+
+// signs text with the session key if there is one and the wallet if not.
+const signText = async (text, session) => {
+	if (session) {
+		return w3.eth.accounts.sign(text, session.privateKey).signature
+	}
+	return await window.ethereum.request({
+		method: "personal_sign",
+		params: [w3.utils.utf8ToHex(text), accountKey],
+	})
+}
+
+// posts a form that comes back with an unsigned post, signs the post itself so it can be trusted
+// wherever it turns up and then publishes it like any other change.
+const signPost = async (url, formData) => {
+	var session = loadSession()
+	if (session) {
+		formData.append("delegation", JSON.stringify(session.delegation))
+	}
+	formData.append("account", account)
+	var response = await fetch(url, { method: "POST", body: formData })
+	if (!response.ok) {
+		throw new Error(await response.text())
+	}
+	// sign exactly the bytes the server sent, that's what it checks against.
+	var rawjson = await response.text()
+	var post = JSON.parse(rawjson)
+	post.Signature = await signText(rawjson, session)
+	var publish = new FormData()
+	publish.append("post", JSON.stringify(post))
+	return await postAndSign("/publish", publish)
+}
+
+// files bigger than this (and anything that isn't an image) go up in resumable chunks before the post.
+const resumableThreshold = 8 * 1024 * 1024
+const uploadChunk = 4 * 1024 * 1024
+
+// tus style upload. A chunk that fails asks the server how far it got and carries on from there.
+const uploadResumable = async (file) => {
+	var tus = { "Tus-Resumable": "1.0.0" }
+	// the server only takes uploads we've signed for so nobody else can use up our quota.
+	var session = loadSession()
+	var signed = Math.floor(Date.now() / 1000)
+	var challenge = "zebu upload of " + file.size + " bytes for " + account + " at " + signed
+	var metadata = [
+		"account " + btoa(account),
+		"signed " + btoa(signed),
+		"signature " + btoa(await signText(challenge, session)),
+	]
+	if (session) {
+		metadata.push("delegation " + btoa(JSON.stringify(session.delegation)))
+	}
+	var response = await fetch("/uploads", {
+		method: "POST",
+		headers: { ...tus, "Upload-Length": file.size, "Upload-Metadata": metadata.join(",") },
+	})
+	if (!response.ok) {
+		throw new Error(await response.text())
+	}
+	var url = response.headers.get("Location")
+	var offset = 0
+	var failures = 0
+	while (true) {
+		try {
+			response = await fetch(url, {
+				method: "PATCH",
+				headers: { ...tus, "Upload-Offset": offset, "Content-Type": "application/offset+octet-stream" },
+				body: file.slice(offset, offset + uploadChunk),
+			})
+			if (!response.ok) {
+				throw new Error(await response.text())
+			}
+			offset = parseInt(response.headers.get("Upload-Offset"))
+			failures = 0
+			if (response.headers.get("Upload-CID")) {
+				return response.headers.get("Upload-CID")
+			}
+		} catch (e) {
+			if (++failures > 5) {
+				throw e
+			}
+			await new Promise(r => setTimeout(r, 1000 * failures))
+			try {
+				response = await fetch(url, { method: "HEAD", headers: tus })
+				offset = parseInt(response.headers.get("Upload-Offset"))
+			} catch (e) {
+				console.log("couldn't get upload offset", e)
+			}
+		}
+	}
+}
+
+// swaps big files in a post form for finished uploads so the post itself stays small.
+const moveLargeFiles = async (formData) => {
+	var files = formData.getAll("images")
+	var alts = formData.getAll("alt")
+	formData.delete("images")
+	formData.delete("alt")
+	for (const [i, file] of files.entries()) {
+		// an empty file input still sends a nameless empty file.
+		if (file.size == 0 && file.name == "") {
+			continue
+		}
+		var alt = alts[i] || ""
+		if (file.size > resumableThreshold || !file.type.startsWith("image/")) {
+			formData.append("uploads", await uploadResumable(file))
+			formData.append("uploadalt", alt)
+		} else {
+			formData.append("images", file)
+			formData.append("alt", alt)
+		}
+	}
+	return formData
+}
+
+// one alt text box per chosen file. The server matches them up by order.
+const describeImages = (input, containerId) => {
+	var container = document.getElementById(containerId)
+	container.replaceChildren()
+	for (const file of input.files) {
+		var label = document.createElement("label")
+		label.textContent = "describe " + file.name + " "
+		var alt = document.createElement("input")
+		alt.type = "text"
+		alt.name = "alt"
+		alt.maxLength = 1500
+		alt.size = 64
+		label.appendChild(alt)
+		container.appendChild(label)
+		container.appendChild(document.createElement("br"))
+	}
+}
+
+// for forms that just change the account like unfollow, mute and block.
+const change = async (event, url) => {
+	event.preventDefault()
+	await postAndSign(url, new FormData(event.target))
+	location.reload()
+}
+
+const repost = async (event) => {
+	event.preventDefault()
+	await signPost("/repost", new FormData(event.target))
+	location.reload()
+}
+
+const edit = async (event) => {
+	event.preventDefault()
+	await signPost("/edit", new FormData(event.target))
+	location.reload()
+}
+
+const deletepost = async (event) => {
+	event.preventDefault()
+	if (!confirm("Delete this post?")) {
+		return
+	}
+	await signPost("/delete", new FormData(event.target))
+	location.reload()
+}
+
+// merging can union revocations which delegates aren't allowed to touch so always use the wallet.
+const merge = async (event) => {
+	event.preventDefault()
+	await postAndSign("/merge", new FormData(event.target), true)
+	location.reload()
+}
+
+// rolling back drops anything posted since and rewrites the whole profile so it's wallet only too.
+const rollback = async (event) => {
+	event.preventDefault()
+	if (!confirm("Roll back to this version? Posts since then will drop off your feed.")) {
+		return
+	}
+	await postAndSign("/rollback", new FormData(event.target), true)
+	location.reload()
+}
+
+// edit and delete only make sense on your own posts.
+window.addEventListener("DOMContentLoaded", () => {
+	if (account == "") {
+		return
+	}
+	document.querySelectorAll('.owner-only').forEach(d => d.hidden = d.dataset.author != account)
+})
+
+// clicking a gallery image opens the original over the page. Arrow keys move through the post's images and escape closes.
+const openLightbox = (items, index) => {
+	var opener = document.activeElement
+	var box = document.createElement("div")
+	box.className = "lightbox"
+	box.setAttribute("role", "dialog")
+	box.setAttribute("aria-modal", "true")
+	box.setAttribute("aria-label", "image viewer")
+	box.tabIndex = -1
+	var figure = document.createElement("figure")
+	var img = document.createElement("img")
+	var caption = document.createElement("figcaption")
+	figure.append(img, caption)
+	var button = (className, label, text, onclick) => {
+		var b = document.createElement("button")
+		b.className = className
+		b.setAttribute("aria-label", label)
+		b.textContent = text
+		b.onclick = (e) => { e.stopPropagation(); onclick() }
+		return b
+	}
+	var show = (i) => {
+		index = (i + items.length) % items.length
+		var link = items[index]
+		img.src = link.href
+		img.alt = link.querySelector("img").alt
+		caption.textContent = link.dataset.alt
+		if (items.length > 1) {
+			caption.textContent += " (" + (index + 1) + " of " + items.length + ")"
+		}
+	}
+	var close = () => {
+		document.removeEventListener("keydown", keys)
+		box.remove()
+		if (opener) {
+			opener.focus()
+		}
+	}
+	var keys = (e) => {
+		if (e.key == "Escape") {
+			close()
+		} else if (e.key == "ArrowLeft") {
+			show(index - 1)
+		} else if (e.key == "ArrowRight") {
+			show(index + 1)
+		} else if (e.key == "Tab") {
+			// keep focus in the dialog.
+			var buttons = Array.from(box.querySelectorAll("button"))
+			var at = buttons.indexOf(document.activeElement)
+			e.preventDefault()
+			buttons[(at + (e.shiftKey ? -1 : 1) + buttons.length) % buttons.length].focus()
+		}
+	}
+	var closeButton = button("lightbox-close", "close", "×", close)
+	box.append(figure, closeButton)
+	if (items.length > 1) {
+		box.append(button("lightbox-prev", "previous image", "‹", () => show(index - 1)))
+		box.append(button("lightbox-next", "next image", "›", () => show(index + 1)))
+	}
+	box.onclick = (e) => { if (e.target == box) close() }
+	document.addEventListener("keydown", keys)
+	show(index)
+	document.body.append(box)
+	closeButton.focus()
+}
+
+document.addEventListener("click", (e) => {
+	var link = e.target.closest("a[data-lightbox]")
+	if (!link || e.ctrlKey || e.metaKey || e.shiftKey) {
+		return
+	}
+	e.preventDefault()
+	var items = Array.from(link.closest(".gallery").querySelectorAll("a[data-lightbox]"))
+	openLightbox(items, items.indexOf(link))
+})
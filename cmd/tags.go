@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"paulgmiller/zebu/zebu"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const tagPageSize = 20
+
+//tagpage is everything we've indexed under a hashtag, newest first, a page at a time.
+func tagpage(backend zebu.Backend, resolvers *zebu.ResolverChain, index *zebu.PostIndex, c *gin.Context) {
+	ctx := c.Request.Context()
+	tag := zebu.NormalizeTag(c.Param("tag"))
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.String(http.StatusBadRequest, "bad page %s", c.Query("page"))
+		return
+	}
+
+	reader, err := reader(backend, c)
+	if err != nil {
+		errorPage(fmt.Errorf("couldn't get reader %w", err), c)
+		return
+	}
+	hide := newHider(resolvers, reader)
+
+	refs, total := index.Tagged(tag, (page-1)*tagPageSize, tagPageSize)
+	posts := []zebu.FetchedPost{}
+	for _, ref := range refs {
+		if hide.hides(ref.Author) {
+			continue
+		}
+		p, err := fetchPost(ctx, backend, resolvers, ref)
+		if err != nil {
+			log.Printf("couldn't fetch tagged %s, %s", ref.CID, err)
+			continue
+		}
+		if hide.hidden(p) {
+			continue
+		}
+		posts = append(posts, p)
+	}
+
+	data := gin.H{
+		"Tag":       tag,
+		"Posts":     posts,
+		"Page":      page,
+		"Total":     total,
+		"Reader":    reader.Name(),
+		"ReaderKey": reader.PublicKey(),
+	}
+	if page > 1 {
+		data["PrevPage"] = page - 1
+	}
+	if page*tagPageSize < total {
+		data["NextPage"] = page + 1
+	}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered:  defaultOffered,
+		Data:     data,
+		HTMLName: "tag.tmpl"})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"paulgmiller/zebu/zebu"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxAncestors = 20
+	maxReplies   = 100
+)
+
+//shows what a post replied to and everything we've indexed that replied to it.
+func threadpage(backend zebu.Backend, resolvers *zebu.ResolverChain, index *zebu.PostIndex, c *gin.Context) {
+	ctx := c.Request.Context()
+	cid := c.Param("cid")
+
+	root, err := backend.GetPost(ctx, cid)
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+	post, err := fetchPost(ctx, backend, resolvers, zebu.PostRef{CID: cid, Author: postAuthorKey(resolvers, root)})
+	if err != nil {
+		errorPage(err, c)
+		return
+	}
+
+	//oldest first
+	ancestors := []zebu.FetchedPost{}
+	parent := post.InReplyTo
+	for i := 0; parent != nil && i < maxAncestors; i++ {
+		p, err := fetchPost(ctx, backend, resolvers, *parent)
+		if err != nil {
+			p = zebu.FetchedPost{CID: parent.CID, Author: parent.Author, RenderedContent: "couldn't find post"}
+			log.Printf("broken thread at %s, %s", parent.CID, err)
+			ancestors = append([]zebu.FetchedPost{p}, ancestors...)
+			break
+		}
+		ancestors = append([]zebu.FetchedPost{p}, ancestors...)
+		parent = p.InReplyTo
+	}
+
+	reader, err := reader(backend, c)
+	if err != nil {
+		errorPage(fmt.Errorf("couldn't get reader %w", err), c)
+		return
+	}
+	hide := newHider(resolvers, reader)
+
+	//breadth first so a huge subthread doesn't starve direct replies.
+	//a hidden reply takes what replied to it with it, same as in the feed where you'd never see them.
+	replies := []zebu.FetchedPost{}
+	seen := map[string]bool{cid: true}
+	queue := index.Replies(cid)
+	for len(queue) > 0 && len(replies) < maxReplies {
+		ref := queue[0]
+		queue = queue[1:]
+		if seen[ref.CID] {
+			continue
+		}
+		seen[ref.CID] = true
+		if hide.hides(ref.Author) {
+			continue
+		}
+		p, err := fetchPost(ctx, backend, resolvers, ref)
+		if err != nil {
+			log.Printf("couldn't fetch reply %s, %s", ref.CID, err)
+			continue
+		}
+		if hide.hidden(p) {
+			continue
+		}
+		replies = append(replies, p)
+		queue = append(queue, index.Replies(ref.CID)...)
+	}
+	sort.Slice(replies, func(i, j int) bool {
+		return replies[i].Created.Before(replies[j].Created)
+	})
+
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered: defaultOffered,
+		Data: gin.H{
+			"Post":      post,
+			"Ancestors": ancestors,
+			"Replies":   replies,
+			"Reader":    reader.Name(),
+			"ReaderKey": reader.PublicKey(),
+		},
+		HTMLName: "thread.tmpl"})
+}
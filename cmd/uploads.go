@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"paulgmiller/zebu/zebu"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//the parts of https://tus.io/protocols/resumable-upload we speak. Enough for tus-js-client and zebu.js.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination"
+	tusChunkType  = "application/offset+octet-stream"
+)
+
+//tus errors have to be the right status for clients to know whether to retry.
+func uploadError(err error, c *gin.Context) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, zebu.ErrUploadNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, zebu.ErrOffsetMismatch):
+		status = http.StatusConflict
+	case errors.Is(err, zebu.ErrUploadBusy):
+		status = http.StatusLocked
+	case errors.Is(err, zebu.ErrUploadTooBig), errors.Is(err, zebu.ErrQuotaExceeded):
+		status = http.StatusRequestEntityTooLarge
+	}
+	c.String(status, err.Error())
+}
+
+//tus metadata is comma separated "key base64value" pairs.
+func uploadMetadata(header string) map[string]string {
+	meta := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 {
+			continue
+		}
+		value := ""
+		if len(fields) > 1 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				continue
+			}
+			value = string(decoded)
+		}
+		meta[fields[0]] = value
+	}
+	return meta
+}
+
+func tusHeaders(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+}
+
+func uploadOptions(c *gin.Context) {
+	tusHeaders(c)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.Itoa(zebu.MaxUploadSize))
+	c.Status(http.StatusNoContent)
+}
+
+//createUpload starts an upload for the account in the metadata. They have to be someone we know and have
+//signed for it, with their wallet or a session key, so nobody else can spend their quota.
+func createUpload(backend zebu.Backend, resolvers *zebu.ResolverChain, uploads *zebu.Uploads, c *gin.Context) {
+	tusHeaders(c)
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "need Upload-Length")
+		return
+	}
+	meta := uploadMetadata(c.GetHeader("Upload-Metadata"))
+	if meta["account"] == "" {
+		c.String(http.StatusBadRequest, "need an account in Upload-Metadata")
+		return
+	}
+	account, err := resolvers.Resolve(meta["account"])
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	owner, err := backend.GetUserById(c.Request.Context(), account)
+	if err != nil {
+		c.String(http.StatusForbidden, "%s isn't registered", account)
+		return
+	}
+	if err := checkUploadChallenge(owner, meta, length, time.Now()); err != nil {
+		c.String(http.StatusForbidden, "upload isn't signed by %s, %s", account, err)
+		return
+	}
+	up, err := uploads.Create(account, length)
+	if err != nil {
+		uploadError(err, c)
+		return
+	}
+	c.Header("Location", "/uploads/"+up.ID)
+	c.Header("Upload-Offset", "0")
+	c.Status(http.StatusCreated)
+}
+
+//how far the time in an upload challenge can be from ours. Long enough for a wallet popup and some clock skew
+//but a challenge someone got hold of isn't good for much.
+const uploadChallengeWindow = 5 * time.Minute
+
+//uploadChallenge is what the client signs to start an upload. zebu.js builds the same string.
+func uploadChallenge(account string, length, signed int64) string {
+	return fmt.Sprintf("zebu upload of %d bytes for %s at %d", length, account, signed)
+}
+
+//checkUploadChallenge makes sure the signature in the metadata is owner's (or a session key of theirs) over the
+//account as they sent it, the length and a recent time.
+func checkUploadChallenge(owner zebu.User, meta map[string]string, length int64, now time.Time) error {
+	signed, err := strconv.ParseInt(meta["signed"], 10, 64)
+	if err != nil {
+		return fmt.Errorf("need when it was signed")
+	}
+	if age := now.Sub(time.Unix(signed, 0)); age > uploadChallengeWindow || age < -uploadChallengeWindow {
+		return fmt.Errorf("signed at %s which is too far from now", time.Unix(signed, 0))
+	}
+	var delegation *zebu.Delegation
+	if raw, found := meta["delegation"]; found {
+		delegation = &zebu.Delegation{}
+		if err := json.Unmarshal([]byte(raw), delegation); err != nil {
+			return fmt.Errorf("bad delegation %w", err)
+		}
+	}
+	challenge := uploadChallenge(meta["account"], length, signed)
+	return zebu.VerifyFor(owner, []byte(challenge), meta["signature"], delegation, zebu.ScopePosts, now)
+}
+
+func uploadHeaders(up zebu.Upload, c *gin.Context) {
+	c.Header("Upload-Offset", strconv.FormatInt(up.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(up.Length, 10))
+	//not tus but the whole point is getting a cid back.
+	if up.CID != "" {
+		c.Header("Upload-CID", up.CID)
+	}
+}
+
+func uploadStatus(uploads *zebu.Uploads, c *gin.Context) {
+	tusHeaders(c)
+	up, err := uploads.Get(c.Param("id"))
+	if err != nil {
+		uploadError(err, c)
+		return
+	}
+	uploadHeaders(up, c)
+	c.Status(http.StatusOK)
+}
+
+func patchUpload(uploads *zebu.Uploads, c *gin.Context) {
+	tusHeaders(c)
+	if c.ContentType() != tusChunkType {
+		c.String(http.StatusUnsupportedMediaType, "chunks have to be %s", tusChunkType)
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "need Upload-Offset")
+		return
+	}
+	up, err := uploads.Write(c.Param("id"), offset, c.Request.Body)
+	if err != nil {
+		uploadError(err, c)
+		return
+	}
+	uploadHeaders(up, c)
+	c.Status(http.StatusNoContent)
+}
+
+func deleteUpload(uploads *zebu.Uploads, c *gin.Context) {
+	tusHeaders(c)
+	if err := uploads.Cancel(c.Param("id")); err != nil {
+		uploadError(err, c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+//attachUploads turns finished uploads into attachments. Only the account that uploaded something can post it.
+//Images still get their metadata stripped and thumbnails made, video and audio go on as they are.
+//uploadalt lines up with uploads the way alt does with images.
+func attachUploads(ctx context.Context, backend zebu.ContentBackend, uploads *zebu.Uploads, account string, form map[string][]string) ([]zebu.Attachment, error) {
+	attachments := []zebu.Attachment{}
+	alts := form["uploadalt"]
+	for i, cid := range form["uploads"] {
+		up, found := uploads.Completed(account, cid)
+		if !found {
+			return nil, fmt.Errorf("%s isn't a finished upload of %s", cid, account)
+		}
+		f, err := backend.Open(ctx, cid)
+		if err != nil {
+			return nil, err
+		}
+		sniff := make([]byte, 512)
+		n, err := io.ReadFull(f, sniff)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			f.Close()
+			return nil, err
+		}
+		err = nil
+		attachment := zebu.Attachment{CID: cid, Type: mediaType(sniff[:n]), Size: up.Length}
+		if strings.HasPrefix(attachment.Type, "image/") {
+			if up.Length > maxImageUpload {
+				f.Close()
+				return nil, fmt.Errorf("%s is too big for an image", cid)
+			}
+			if _, err = f.Seek(0, io.SeekStart); err == nil {
+				attachment, err = zebu.SaveImage(ctx, backend, f)
+			}
+		}
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't attach %s, %w", cid, err)
+		}
+		//the raw upload still has the exif (gps and all) we just stripped so don't keep it around.
+		if attachment.CID != cid {
+			if err := backend.Remove(ctx, cid); err != nil {
+				log.Printf("couldn't remove raw upload %s, %s", cid, err)
+			}
+		}
+		if i < len(alts) {
+			if attachment.Alt, err = altText(alts[i]); err != nil {
+				return nil, err
+			}
+		}
+		uploads.Attached(up.ID)
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"paulgmiller/zebu/zebu"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+)
+
+func TestUploadMetadata(t *testing.T) {
+	meta := uploadMetadata("account " + base64.StdEncoding.EncodeToString([]byte("alice.eth")) + ",is_confidential, filename !!!")
+	if meta["account"] != "alice.eth" {
+		t.Fatalf("got %v", meta)
+	}
+	if _, found := meta["is_confidential"]; !found {
+		t.Fatalf("keys without values count %v", meta)
+	}
+	if _, found := meta["filename"]; found {
+		t.Fatalf("bad base64 should be skipped %v", meta)
+	}
+}
+
+func TestPatchUpload(t *testing.T) {
+	backend := &mediaBackend{objects: map[string][]byte{}}
+	uploads := zebu.NewUploads(backend, 1<<20)
+	router := gin.New()
+	router.HEAD("/uploads/:id", func(c *gin.Context) { uploadStatus(uploads, c) })
+	router.PATCH("/uploads/:id", func(c *gin.Context) { patchUpload(uploads, c) })
+	patch := func(id string, offset string, ctype string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/uploads/"+id, bytes.NewReader(body))
+		req.Header.Set("Upload-Offset", offset)
+		req.Header.Set("Content-Type", ctype)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	data := bytes.Repeat([]byte("z"), 100)
+	up, err := uploads.Create("0xalice", int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := patch(up.ID, "0", "text/plain", data); w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415 got %d", w.Code)
+	}
+	w := patch(up.ID, "0", tusChunkType, data[:40])
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "40" || w.Header().Get("Tus-Resumable") != tusVersion {
+		t.Fatalf("got %d %v", w.Code, w.Header())
+	}
+	if w := patch(up.ID, "0", tusChunkType, data); w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 got %d", w.Code)
+	}
+
+	head := httptest.NewRecorder()
+	router.ServeHTTP(head, httptest.NewRequest(http.MethodHead, "/uploads/"+up.ID, nil))
+	if head.Code != http.StatusOK || head.Header().Get("Upload-Offset") != "40" || head.Header().Get("Upload-Length") != "100" {
+		t.Fatalf("got %d %v", head.Code, head.Header())
+	}
+
+	w = patch(up.ID, "40", tusChunkType, data[40:])
+	cid := w.Header().Get("Upload-CID")
+	if w.Code != http.StatusNoContent || cid == "" || !bytes.Equal(backend.objects[cid], data) {
+		t.Fatalf("got %d %v", w.Code, w.Header())
+	}
+
+	if w := patch("nope", "0", tusChunkType, data); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 got %d", w.Code)
+	}
+
+	if _, err := attachUploads(context.Background(), backend, uploads, "0xmallory", map[string][]string{"uploads": {cid}}); err == nil {
+		t.Fatalf("mallory attached alice's upload")
+	}
+	attached, err := attachUploads(context.Background(), backend, uploads, "0xalice", map[string][]string{"uploads": {cid}, "uploadalt": {" zzzz "}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attached) != 1 || attached[0].CID != cid || attached[0].Type != "application/octet-stream" || attached[0].Size != 100 || attached[0].Alt != "zzzz" {
+		t.Fatalf("got %+v", attached)
+	}
+	uploads.Expire(time.Now().Add(48 * time.Hour))
+	if _, found := backend.objects[cid]; !found {
+		t.Fatalf("expiring uploads removed one that's on a post")
+	}
+}
+
+func TestAttachImageRemovesRawUpload(t *testing.T) {
+	backend := &mediaBackend{objects: map[string][]byte{}}
+	uploads := zebu.NewUploads(backend, 1<<20)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	up, err := uploads.Create("0xalice", int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, err = uploads.Write(up.ID, 0, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attached, err := attachUploads(context.Background(), backend, uploads, "0xalice", map[string][]string{"uploads": {up.CID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attached) != 1 || attached[0].CID == up.CID || backend.objects[attached[0].CID] == nil {
+		t.Fatalf("expected a stripped copy got %+v", attached)
+	}
+	if _, found := backend.objects[up.CID]; found {
+		t.Fatalf("raw upload %s is still around", up.CID)
+	}
+}
+
+func TestUploadChallenge(t *testing.T) {
+	ownerkey, _ := crypto.GenerateKey()
+	sessionkey, _ := crypto.GenerateKey()
+	owner := zebu.EthereumSigner{Key: ownerkey}
+	session := zebu.EthereumSigner{Key: sessionkey}
+	user := zebu.User{PublicName: owner.PublicKey()}
+	now := time.Now()
+	signed := func(signer zebu.Signer, account string, length int64, at time.Time) map[string]string {
+		sig, err := signer.Sign([]byte(uploadChallenge(account, length, at.Unix())))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return map[string]string{"account": account, "signed": strconv.FormatInt(at.Unix(), 10), "signature": sig}
+	}
+
+	if err := checkUploadChallenge(user, signed(owner, "alice.eth", 100, now), 100, now); err != nil {
+		t.Fatalf("owner's own signature didn't check, %v", err)
+	}
+	if err := checkUploadChallenge(user, map[string]string{"account": "alice.eth"}, 100, now); err == nil {
+		t.Fatalf("unsigned upload was let through")
+	}
+	if err := checkUploadChallenge(user, signed(session, "alice.eth", 100, now), 100, now); err == nil {
+		t.Fatalf("someone else's key was let through")
+	}
+	if err := checkUploadChallenge(user, signed(owner, "alice.eth", 100, now), 1<<20, now); err == nil {
+		t.Fatalf("signature for a different length was let through")
+	}
+	if err := checkUploadChallenge(user, signed(owner, "alice.eth", 100, now.Add(-time.Hour)), 100, now); err == nil {
+		t.Fatalf("stale signature was let through")
+	}
+
+	d, err := zebu.NewDelegation(ownerkey, session.PublicKey(), now.Add(time.Hour), zebu.ScopePosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	djson, _ := json.Marshal(d)
+	meta := signed(session, "alice.eth", 100, now)
+	meta["delegation"] = string(djson)
+	if err := checkUploadChallenge(user, meta, 100, now); err != nil {
+		t.Fatalf("session key didn't check, %v", err)
+	}
+	user.RevokedDelegates = []string{session.PublicKey()}
+	if err := checkUploadChallenge(user, meta, 100, now); err == nil {
+		t.Fatalf("revoked session key was let through")
+	}
+}
@@ -52,6 +52,7 @@ func TestPost(t *testing.T) {
 	if unr.PubKey != addr {
 		t.Fatalf("bad pub key %s", unr.PubKey)
 	}
+	unr.Scheme = zebu.EIP712ChainScheme
 	unr.Sign(privatekey)
 	jbytes, err := json.Marshal(unr)
 	must(err, t, "marshal")
@@ -0,0 +1,76 @@
+package zebu
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	//a failed avatar is tried again after this.
+	avatarRetry = 10 * time.Minute
+	//a saved one is fetched again after this in case it's changed. The old one shows until then.
+	avatarKeep = 24 * time.Hour
+	//past this many urls we sweep out expired ones when adding.
+	avatarSweep = 10000
+)
+
+type savedAvatar struct {
+	cid     string
+	expires time.Time
+}
+
+//Avatars copies https avatars from ens records into ipfs so pages show our copy and readers' browsers never go to
+//whatever site the record points at. Each url is fetched in the background the first time it's asked for and there's
+//no avatar until that's done.
+type Avatars struct {
+	fetcher *PreviewFetcher
+	backend ContentBackend
+	now     func() time.Time
+
+	lock  sync.Mutex
+	saved map[string]savedAvatar
+	wg    sync.WaitGroup //fetches in flight, for tests
+}
+
+func NewAvatars(fetcher *PreviewFetcher, backend ContentBackend) *Avatars {
+	return &Avatars{fetcher: fetcher, backend: backend, now: time.Now, saved: map[string]savedAvatar{}}
+}
+
+//CID is our copy of the avatar at rawurl or "" if we don't have one yet.
+func (a *Avatars) CID(rawurl string) string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	now := a.now()
+	saved, found := a.saved[rawurl]
+	if found && now.Before(saved.expires) {
+		return saved.cid
+	}
+	if len(a.saved) > avatarSweep {
+		for u, s := range a.saved {
+			if !now.Before(s.expires) {
+				delete(a.saved, u)
+			}
+		}
+	}
+	//whatever we had carries on while we fetch and anyone else asking doesn't fetch too.
+	a.saved[rawurl] = savedAvatar{cid: saved.cid, expires: now.Add(avatarRetry)}
+	a.wg.Add(1)
+	go a.save(rawurl)
+	return saved.cid
+}
+
+func (a *Avatars) save(rawurl string) {
+	defer a.wg.Done()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*previewTimeout)
+	defer cancel()
+	cid, err := a.fetcher.saveImage(ctx, a.backend, rawurl)
+	if err != nil {
+		log.Printf("couldn't save avatar %s, %s", rawurl, err)
+		return
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.saved[rawurl] = savedAvatar{cid: cid, expires: a.now().Add(avatarKeep)}
+}
@@ -0,0 +1,39 @@
+package zebu
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestAvatars(t *testing.T) {
+	server := previewServer(t)
+	m := newMemBackend()
+	avatars := NewAvatars(NewPreviewFetcher(netip.MustParsePrefix("127.0.0.1/32")), m)
+	now := time.Now()
+	avatars.now = func() time.Time { return now }
+
+	if cid := avatars.CID(server.URL + "/card.png"); cid != "" {
+		t.Fatalf("shouldn't have an avatar before it's fetched got %s", cid)
+	}
+	avatars.wg.Wait()
+	cid := avatars.CID(server.URL + "/card.png")
+	if _, err := m.get(cid); err != nil {
+		t.Fatalf("expected our copy of the avatar got %q, %v", cid, err)
+	}
+
+	if avatars.CID(server.URL+"/missing") != "" {
+		t.Fatalf("missing avatar should be blank")
+	}
+	avatars.wg.Wait()
+	if avatars.CID(server.URL+"/missing") != "" || len(avatars.saved) != 2 {
+		t.Fatalf("a failed avatar shouldn't be fetched again straight away")
+	}
+
+	//stale ones are fetched again but still show meanwhile.
+	now = now.Add(avatarKeep + time.Minute)
+	if again := avatars.CID(server.URL + "/card.png"); again != cid {
+		t.Fatalf("expected the old copy while fetching got %s", again)
+	}
+	avatars.wg.Wait()
+}
@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
 	"strings"
@@ -27,12 +26,17 @@ type Backend interface {
 	UserBackend
 	Healthz
 	RandomUsers(int) []string
+	Users() []string
 }
 
 type UserBackend interface {
 	GetUserById(ctx context.Context, usercid string) (User, error)
 	PublishUser(ctx context.Context, unr UserNameRecord) error
 	SaveUserCid(ctx context.Context, user User) (UserNameRecord, error)
+	//records that conflict with the one we're using. Merge one to make it go away.
+	Forks(pubkey string) []Fork
+	//every record we've accepted for pubkey, newest first.
+	History(ctx context.Context, pubkey string) ([]UserNameRecord, error)
 }
 
 type Healthz interface {
@@ -40,11 +44,16 @@ type Healthz interface {
 }
 
 type ContentBackend interface {
-	GetPosts(ctx context.Context, user User, count int) <-chan Post
+	//only Post and CID are filled in.
+	GetPosts(ctx context.Context, user User, count int) <-chan FetchedPost
+	GetPost(ctx context.Context, cid string) (Post, error)
 	SavePost(ctx context.Context, post Post) (string, error)
 	//too low level? used for images currently
 	Cat(ctx context.Context, cid string) (io.ReadCloser, error)
 	Add(ctx context.Context, r io.Reader) (string, error)
+	Open(ctx context.Context, cid string) (io.ReadSeekCloser, error)
+	//Remove unpins cid and deletes its blocks. For things we added but shouldn't keep like raw uploads.
+	Remove(ctx context.Context, cid string) error
 }
 
 var _ Backend = &IpfsBackend{}
@@ -58,6 +67,8 @@ type IpfsBackend struct {
 	lock         sync.RWMutex
 	records      map[string]UserNameRecord
 	healthrecord path.Path
+	pins         *pinRefs //what deleted posts leave that we can stop hosting.
+	forks        forks
 }
 
 func NewIpfsBackend(ctx context.Context) *IpfsBackend {
@@ -95,6 +106,8 @@ func NewIpfsBackend(ctx context.Context) *IpfsBackend {
 	backend := &IpfsBackend{
 		api:          ipfsapi,
 		records:      map[string]UserNameRecord{},
+		pins:         newPinRefs(),
+		forks:        forks{},
 		healthrecord: hr,
 		shell:        shell,
 	}
@@ -129,6 +142,17 @@ func (b *IpfsBackend) RandomUsers(n int) []string {
 	return users
 }
 
+//every public key we have a record for.
+func (b *IpfsBackend) Users() []string {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	users := make([]string, 0, len(b.records))
+	for k := range b.records {
+		users = append(users, k)
+	}
+	return users
+}
+
 func (b *IpfsBackend) Healthz(ctx context.Context) bool {
 	ctx, cancel := context.WithTimeout(ctx, time.Second)
 	defer cancel()
@@ -184,6 +208,26 @@ func (b *IpfsBackend) listen(ctx context.Context) error {
 				b.lock.Lock()
 				defer b.lock.Unlock()
 				existing := b.records[unr.PubKey]
+				if unr.Sequence == existing.Sequence && conflicts(existing, *unr) && !b.forks.has(unr.PubKey, unr.CID) {
+					//first one we saw wins until they merge.
+					var user User
+					if err := b.readJson(unr.CID, &user); err != nil {
+						log.Printf("unable to read forked user %s at %s", unr.PubKey, unr.CID)
+						return
+					}
+					//a delegate can't sneak changes in as a fork. Compare with what it was built on, not its sibling.
+					base := existing
+					if unr.Previous != "" {
+						base = UserNameRecord{CID: unr.Previous}
+					}
+					if err := b.checkDelegate(base, *unr, user); err != nil {
+						log.Printf("rejecting delegated fork %s", err)
+						return
+					}
+					log.Printf("fork for %s at sequence %d, %s vs %s", unr.PubKey, unr.Sequence, existing.CID, unr.CID)
+					b.forks.add(Fork{Record: *unr, User: user})
+					return
+				}
 				if unr.Sequence > existing.Sequence {
 					log.Printf("update is new %s %d,%d", unr.PubKey, unr.Sequence, existing.Sequence)
 					var user User
@@ -196,12 +240,15 @@ func (b *IpfsBackend) listen(ctx context.Context) error {
 						log.Printf("user has no name %s", unr.PubKey)
 						return
 					}
+					if err := b.checkDelegate(existing, *unr, user); err != nil {
+						log.Printf("rejecting delegated update %s", err)
+						return
+					}
+					b.trackForks(existing, *unr)
 					b.records[unr.PubKey] = *unr
-					usertopic := centraltopic + "/" + string(unr.PubKey)
-					if err := b.shell.FilesWrite(ctx, usertopic, bytes.NewReader(msg.Data()), ipfs.FilesWrite.Create(true), ipfs.FilesWrite.Parents(true)); err != nil {
-						log.Printf("failed to save %s", unr.PubKey)
+					if err := b.saveRecord(ctx, *unr, msg.Data()); err != nil {
+						log.Printf("failed to save %s, %s", unr.PubKey, err)
 					}
-					log.Printf("wrote to %s", usertopic)
 				}
 			}()
 		}
@@ -238,13 +285,10 @@ func (b *IpfsBackend) republishRecords(ctx context.Context) {
 			}
 			for _, f := range users {
 
-				reader, err := b.Cat(ctx, f.Hash)
-				if err != nil {
-					log.Printf("failed to read %s,%s", f.Name, f.Hash)
-				}
-				bytes, err := ioutil.ReadAll(reader)
+				bytes, err := b.readMfs(ctx, currentPath(f.Name))
 				if err != nil {
-					log.Printf("failed to read %s,%s", f.Name, f.Hash)
+					log.Printf("failed to read %s, %s", f.Name, err)
+					continue
 				}
 
 				usertopic := centraltopic + "/" + f.Name
@@ -277,13 +321,22 @@ func (b *IpfsBackend) loadRecords(ctx context.Context) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 	for _, f := range users {
-
-		reader, err := b.Cat(ctx, f.Hash)
+		pubkey := f.Name
+		if f.Type == mfsFile {
+			//the old file is kept until this works so we can try again next time.
+			if err := b.migrateRecord(ctx, f.Name); err != nil {
+				log.Printf("couldn't migrate user %s: %s", f.Name, err)
+				continue
+			}
+			pubkey = strings.TrimSuffix(f.Name, migratingSuffix)
+		}
+		data, err := b.readMfs(ctx, currentPath(pubkey))
 		if err != nil {
-			log.Printf("failed to read %s,%s", f.Name, f.Hash)
+			log.Printf("failed to read %s, %s", pubkey, err)
+			continue
 		}
 		var unr UserNameRecord
-		err = json.NewDecoder(reader).Decode(&unr)
+		err = json.Unmarshal(data, &unr)
 		if err != nil {
 			log.Fatalf("could't read user %s: %s", f.Name, err)
 		}
@@ -339,6 +392,12 @@ func (b *IpfsBackend) SavePost(ctx context.Context, post Post) (string, error) {
 	return b.writeJson(&post)
 }
 
+func (b *IpfsBackend) GetPost(ctx context.Context, cid string) (Post, error) {
+	var post Post
+	err := b.readJson(cid, &post)
+	return post, err
+}
+
 func (b *IpfsBackend) Cat(ctx context.Context, cidstr string) (io.ReadCloser, error) {
 	start := time.Now()
 	defer func() {
@@ -370,6 +429,32 @@ func (b *IpfsBackend) Add(ctx context.Context, r io.Reader) (string, error) {
 	return path.Cid().String(), nil
 }
 
+func (b *IpfsBackend) Remove(ctx context.Context, cidstr string) error {
+	c, err := cidlib.Parse(cidstr)
+	if err != nil {
+		return err
+	}
+	if err := b.api.Pin().Rm(ctx, path.IpfsPath(c)); err != nil {
+		return err
+	}
+	//list the children before the root goes or we can't find them.
+	refs, err := b.shell.Refs(cidstr, true)
+	if err != nil {
+		return err
+	}
+	blocks := []string{cidstr}
+	for ref := range refs {
+		blocks = append(blocks, ref)
+	}
+	for _, block := range blocks {
+		//ipfs won't remove blocks something pinned still needs which is what we want if they're shared.
+		if err := b.api.Block().Rm(ctx, path.New(block)); err != nil && block == cidstr {
+			return err
+		}
+	}
+	return nil
+}
+
 func AddString(ctx context.Context, backend Backend, content string) (string, error) {
 	return backend.Add(ctx, strings.NewReader(content))
 }
@@ -401,11 +486,52 @@ func (b *IpfsBackend) SaveUserCid(ctx context.Context, user User) (UserNameRecor
 	b.lock.RUnlock()
 	existing.Sequence += 1
 	existing.PubKey = user.PublicName //just in case there was no existing
+	existing.Previous = existing.CID
+	existing.Merged = ""
 	existing.CID = cid
 	existing.Signature = "" //no longer valid
+	existing.Delegation = nil
+	existing.Scheme = LegacyScheme //whoever signs picks, legacy signers have to drop Previous
 	return existing, nil
 }
 
+//Forks we know about for pubkey.
+func (b *IpfsBackend) Forks(pubkey string) []Fork {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return append([]Fork{}, b.forks[pubkey]...)
+}
+
+//call with the lock held when unr is about to replace existing.
+//if unr wasn't built on existing then existing becomes a fork so it doesn't just get lost.
+func (b *IpfsBackend) trackForks(existing, unr UserNameRecord) {
+	if conflicts(existing, unr) && existing.CID != unr.Merged {
+		var user User
+		if err := b.readJson(existing.CID, &user); err != nil {
+			log.Printf("unable to read orphaned user %s at %s", existing.PubKey, existing.CID)
+		} else {
+			log.Printf("%s replaced %s without building on it", unr.CID, existing.CID)
+			b.forks.add(Fork{Record: existing, User: user})
+		}
+	}
+	b.forks.resolve(unr)
+}
+
+//delegates are limited in what they can change so compare against the record we had.
+func (b *IpfsBackend) checkDelegate(old UserNameRecord, unr UserNameRecord, updated User) error {
+	if unr.Delegation == nil {
+		return nil
+	}
+	//if we've never seen them we've nothing to compare against.
+	olduser := updated
+	if old.CID != "" {
+		if err := b.readJson(old.CID, &olduser); err != nil {
+			return fmt.Errorf("couldn't read previous user %s, %w", old.CID, err)
+		}
+	}
+	return CheckDelegatedChange(*unr.Delegation, olduser, updated)
+}
+
 func (b *IpfsBackend) PublishUser(ctx context.Context, u UserNameRecord) error {
 	if !u.Validate() {
 		return fmt.Errorf("Invalid user %v", u)
@@ -422,17 +548,28 @@ func (b *IpfsBackend) PublishUser(ctx context.Context, u UserNameRecord) error {
 		if found && old.Sequence > u.Sequence {
 			return fmt.Errorf("found newer record with sequence %d", old.Sequence)
 		}
+		if u.Delegation != nil {
+			var updated User
+			if err := b.readJson(u.CID, &updated); err != nil {
+				return err
+			}
+			if err := b.checkDelegate(old, u, updated); err != nil {
+				return err
+			}
+		}
+		if found {
+			b.trackForks(old, u)
+		}
 		//some sort of dead lock
 		b.records[u.PubKey] = u
 	}
 	usertopic := centraltopic + "/" + u.PubKey
 
 	//if _, err := b.api.Unixfs().Add(ctx, files.NewBytesFile(ujsonbytes)); err != nil {
-	if err := b.shell.FilesWrite(ctx, usertopic, bytes.NewReader(ujsonbytes), ipfs.FilesWrite.Create(true), ipfs.FilesWrite.Parents(true)); err != nil {
+	if err := b.saveRecord(ctx, u, ujsonbytes); err != nil {
 		log.Printf("failed to write to %s, %s", usertopic, err)
 		return err
 	}
-	log.Printf("wrote to %s", usertopic)
 	//so to start with we'll publish everythig to one path to make everthing findable. Eventually that will explode
 
 	if err := b.api.PubSub().Publish(ctx, centraltopic, ujsonbytes); err != nil {
@@ -446,23 +583,52 @@ func (b *IpfsBackend) PublishUser(ctx context.Context, u UserNameRecord) error {
 }
 
 //offset
-func (b *IpfsBackend) GetPosts(ctx context.Context, user User, count int) <-chan Post {
-	var posts = make(chan Post) //could buffer count buut current consumers pull these off prety fast.
-	head := user.LastPost
+func (b *IpfsBackend) GetPosts(ctx context.Context, user User, count int) <-chan FetchedPost {
+	walked := walkPosts(user, count, func(cid string) (Post, error) {
+		return b.GetPost(ctx, cid)
+	}, b.unpinDeleted)
+	posts := make(chan FetchedPost)
 	go func() {
-		for i := 0; head != "" && i < count; i++ {
-			var post Post
-			if err := b.readJson(head, &post); err != nil {
-				fallback := fmt.Sprintf("Error can't resolve content %s: %s", head, err)
-				log.Print(fallback)
-				posts <- Post{Content: fallback}
-				close(posts)
-				return
+		defer close(posts)
+		for p := range walked {
+			if repin := b.pins.seen(p); len(repin) > 0 {
+				go b.setPins(repin, true)
 			}
-			posts <- post
-			head = post.Previous
+			posts <- p
 		}
-		close(posts)
 	}()
 	return posts
 }
+
+//we honor deletes so stop hosting the deleted post and what it showed that no live post still uses.
+//Other nodes might still have it.
+func (b *IpfsBackend) unpinDeleted(p FetchedPost) {
+	if unpin := b.pins.gone(p); len(unpin) > 0 {
+		go b.setPins(unpin, false)
+	}
+}
+
+func (b *IpfsBackend) setPins(cids []string, pinned bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, c := range cids {
+		cid, err := cidlib.Parse(c)
+		if err != nil {
+			continue
+		}
+		if pinned {
+			if err := b.api.Pin().Add(ctx, path.IpfsPath(cid)); err != nil {
+				log.Printf("couldn't pin %s again, %s", c, err)
+				continue
+			}
+			log.Printf("pinned %s again, a live post uses it", c)
+			continue
+		}
+		//not being pinned is fine we might never have had it.
+		if err := b.api.Pin().Rm(ctx, path.IpfsPath(cid)); err != nil {
+			log.Printf("couldn't unpin deleted %s, %s", c, err)
+			continue
+		}
+		log.Printf("unpinned deleted %s", c)
+	}
+}
@@ -0,0 +1,102 @@
+package zebu
+
+import (
+	"image"
+	"math"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+//Blurhash is the short string clients paint while an image loads. See https://blurha.sh
+//4x3 components is what everyone else uses and comes out at 28 characters.
+func Blurhash(img image.Image) string {
+	const xComponents, yComponents = 4, 3
+	//the hash only has a dozen numbers in it so there's no point looking at every pixel of a photo.
+	small := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	var factors [xComponents * yComponents][3]float64
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			factors[j*xComponents+i] = blurFactor(small, i, j)
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(base83((xComponents-1)+(yComponents-1)*9, 1))
+	maximum := 0.0
+	for _, f := range factors[1:] {
+		for _, c := range f {
+			maximum = math.Max(maximum, math.Abs(c))
+		}
+	}
+	quantisedMax := int(math.Max(0, math.Min(82, math.Floor(maximum*166-0.5))))
+	hash.WriteString(base83(quantisedMax, 1))
+	maximum = float64(quantisedMax+1) / 166
+
+	dc := factors[0]
+	hash.WriteString(base83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+	for _, f := range factors[1:] {
+		ac := 0
+		for _, c := range f {
+			q := int(math.Max(0, math.Min(18, math.Floor(signPow(c/maximum, 0.5)*9+9.5))))
+			ac = ac*19 + q
+		}
+		hash.WriteString(base83(ac, 2))
+	}
+	return hash.String()
+}
+
+func blurFactor(img *image.RGBA, i, j int) [3]float64 {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	normalisation := 2.0
+	if i == 0 && j == 0 {
+		normalisation = 1
+	}
+	var f [3]float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			basis := normalisation * math.Cos(math.Pi*float64(i*x)/float64(w)) * math.Cos(math.Pi*float64(j*y)/float64(h))
+			p := img.Pix[img.PixOffset(x, y):]
+			for c := 0; c < 3; c++ {
+				f[c] += basis * sRGBToLinear(p[c])
+			}
+		}
+	}
+	for c := range f {
+		f[c] /= float64(w * h)
+	}
+	return f
+}
+
+func sRGBToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+func base83(value, length int) string {
+	out := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		out[i] = base83Chars[value%83]
+		value /= 83
+	}
+	return string(out)
+}
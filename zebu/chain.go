@@ -0,0 +1,61 @@
+package zebu
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+//InChain walks back depth posts from users head looking for cid.
+//posts don't know who owns them so this is how you check a post claiming an author actually came from them.
+func InChain(ctx context.Context, backend ContentBackend, user User, cid string, depth int) bool {
+	found := false
+	//drain the channel so GetPosts doesn't leak.
+	for p := range backend.GetPosts(ctx, user, depth) {
+		if p.CID == cid {
+			found = true
+		}
+	}
+	return found
+}
+
+//things a chain can get wrong. Posts are self declared so none of this is proof, just reasons to trust a post less.
+const (
+	FutureCreated = "created in the future"
+	OutOfOrder    = "created after a later post"
+	WrongAuthor   = "author is someone else's key"
+)
+
+//how far ahead of us someone elses clock can be before we call it the future.
+const ClockSkew = 5 * time.Minute
+
+//chainValidator is fed posts newest first as a chain is walked.
+type chainValidator struct {
+	owner User
+	now   time.Time
+	newer time.Time //created time of the last post we saw. Everything after should be older.
+}
+
+func newChainValidator(owner User) *chainValidator {
+	return &chainValidator{owner: owner, now: time.Now()}
+}
+
+func (v *chainValidator) check(p Post) []string {
+	var violations []string
+	future := p.Created.After(v.now.Add(ClockSkew))
+	if future {
+		violations = append(violations, FutureCreated)
+	} else if !v.newer.IsZero() && p.Created.After(v.newer) {
+		violations = append(violations, OutOfOrder)
+	}
+	//only keys can be compared. A name is whatever the owner called themselves when they posted, they
+	//rename and names change hands, so an old one isn't a wrong one. Imported posts don't set an author at all.
+	if IsPublicKey(p.Author) && !strings.EqualFold(p.Author, v.owner.PublicKey()) {
+		violations = append(violations, WrongAuthor)
+	}
+	//don't let a single future post make everything older look out of order.
+	if !future {
+		v.newer = p.Created
+	}
+	return violations
+}
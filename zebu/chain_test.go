@@ -0,0 +1,71 @@
+package zebu
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInChain(t *testing.T) {
+	m := newMemBackend()
+	alice := User{PublicName: "0xA11CE"}
+	bob := User{PublicName: "0xB0B"}
+
+	first := m.post(t, &alice, Post{Content: "first"})
+	m.post(t, &alice, Post{Content: "second"})
+	m.post(t, &alice, Post{Content: "third"})
+	bobs := m.post(t, &bob, Post{Content: "not alice"})
+
+	ctx := context.Background()
+	if !InChain(ctx, m, alice, first, 10) {
+		t.Fatalf("first post should be in chain")
+	}
+	if InChain(ctx, m, alice, first, 2) {
+		t.Fatalf("first post is past depth")
+	}
+	if InChain(ctx, m, alice, bobs, 10) {
+		t.Fatalf("bobs post isn't alices")
+	}
+}
+
+func TestChainValidation(t *testing.T) {
+	m := newMemBackend()
+	alice := User{PublicName: "0xA11CE", DisplayName: "alice.northbriton.net"}
+	now := time.Now().UTC()
+
+	m.post(t, &alice, Post{Content: "old", Created: now.Add(-3 * time.Hour)})
+	backdated := m.post(t, &alice, Post{Content: "backdated", Created: now.Add(-time.Hour)})
+	m.post(t, &alice, Post{Content: "earlier", Created: now.Add(-2 * time.Hour)})
+	future := m.post(t, &alice, Post{Content: "future", Created: now.Add(24 * time.Hour)})
+	//m.post stamps alices name so sneak posts in with others.
+	renamed := Post{Content: "before I renamed", Created: now.Add(-time.Minute), Previous: alice.LastPost, Author: "wilkes.northbriton.net"}
+	alice.LastPost, _ = m.SavePost(context.Background(), renamed)
+	imposter := Post{Content: "imposter", Created: now, Previous: alice.LastPost, Author: "0xB0B"}
+	imposterCid, _ := m.SavePost(context.Background(), imposter)
+	alice.LastPost = imposterCid
+
+	violations := map[string][]string{}
+	for p := range m.GetPosts(context.Background(), alice, 10) {
+		violations[p.CID] = p.Violations
+	}
+	if len(violations) != 6 {
+		t.Fatalf("expected 6 posts got %d", len(violations))
+	}
+	expected := map[string]string{
+		imposterCid: WrongAuthor,
+		future:      FutureCreated,
+		backdated:   OutOfOrder,
+	}
+	for cid, v := range violations {
+		want, bad := expected[cid]
+		if !bad {
+			if len(v) != 0 {
+				t.Fatalf("%s shouldn't have violations %v", cid, v)
+			}
+			continue
+		}
+		if len(v) != 1 || v[0] != want {
+			t.Fatalf("%s expected %s got %v", cid, want, v)
+		}
+	}
+}
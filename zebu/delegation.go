@@ -0,0 +1,162 @@
+package zebu
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+//What a delegate is allowed to change. No scopes means anything but delegation itself.
+const (
+	ScopePosts   = "posts"   //LastPost
+	ScopeFollows = "follows" //Follows, Muted and Blocked
+)
+
+//Delegation is signed by Owner's main key and lets Delegate (usually a session key in a browser) sign records for them.
+//saves a wallet popup on every post and means the importer doesn't need to hand master keys around.
+type Delegation struct {
+	Owner     string
+	Delegate  string   //address of the session key
+	Expires   int64    `json:"Expires,omitempty"` //unix seconds, zero never expires
+	Scopes    []string `json:"Scopes,omitempty"`
+	Signature string   `json:"Signature,omitempty"`
+}
+
+func (d Delegation) TypedData() apitypes.TypedData {
+	scopes := []interface{}{}
+	for _, s := range d.Scopes {
+		scopes = append(scopes, s)
+	}
+	return apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": recordTypes["EIP712Domain"],
+			"Delegation": {
+				{Name: "Owner", Type: "string"},
+				{Name: "Delegate", Type: "string"},
+				{Name: "Expires", Type: "uint64"},
+				{Name: "Scopes", Type: "string[]"},
+			},
+		},
+		PrimaryType: "Delegation",
+		Domain:      zebuDomain,
+		Message: apitypes.TypedDataMessage{
+			"Owner":    d.Owner,
+			"Delegate": d.Delegate,
+			"Expires":  strconv.FormatInt(d.Expires, 10),
+			"Scopes":   scopes,
+		},
+	}
+}
+
+//NewDelegation signs a delegation to delegate with owners key.
+func NewDelegation(owner *ecdsa.PrivateKey, delegate string, expires time.Time, scopes ...string) (Delegation, error) {
+	d := Delegation{
+		Owner:    crypto.PubkeyToAddress(owner.PublicKey).Hex(),
+		Delegate: delegate,
+		Scopes:   scopes,
+	}
+	if !expires.IsZero() {
+		d.Expires = expires.Unix()
+	}
+	hash, err := typedDataHash(d.TypedData())
+	if err != nil {
+		return d, err
+	}
+	d.Signature, err = signHash(hash, owner)
+	return d, err
+}
+
+//Check makes sure owner really signed this and it hasn't expired. Revocation lives in the User so the backend checks that.
+func (d Delegation) Check(owner string, now time.Time) error {
+	if d.Owner != owner {
+		return fmt.Errorf("delegation is for %s not %s", d.Owner, owner)
+	}
+	if d.Expires != 0 && now.Unix() > d.Expires {
+		return fmt.Errorf("delegation to %s expired at %s", d.Delegate, time.Unix(d.Expires, 0))
+	}
+	hash, err := typedDataHash(d.TypedData())
+	if err != nil {
+		return err
+	}
+	signer, err := recoverHash(hash, d.Signature)
+	if err != nil {
+		return err
+	}
+	if signer != d.Owner {
+		return fmt.Errorf("delegation signed by %s not %s", signer, d.Owner)
+	}
+	return nil
+}
+
+func (d Delegation) allows(scope string) bool {
+	if len(d.Scopes) == 0 {
+		return true
+	}
+	return hasName(d.Scopes, scope)
+}
+
+//SignDelegated signs unr with a delegates key and attaches the delegation that lets it.
+func (unr *UserNameRecord) SignDelegated(delegatekey *ecdsa.PrivateKey, d Delegation) error {
+	unr.Delegation = &d
+	return unr.Sign(delegatekey)
+}
+
+//VerifyFor checks owner signed data, or a delegate they let do scope and haven't revoked did.
+//For one off proofs that aren't records or posts like starting an upload.
+func VerifyFor(owner User, data []byte, sig string, d *Delegation, scope string, now time.Time) error {
+	if d == nil {
+		return verify(owner.PublicKey(), data, sig)
+	}
+	if err := d.Check(owner.PublicKey(), now); err != nil {
+		return err
+	}
+	if !d.allows(scope) {
+		return fmt.Errorf("delegate %s isn't allowed %s", d.Delegate, scope)
+	}
+	if hasName(owner.RevokedDelegates, d.Delegate) {
+		return fmt.Errorf("delegate %s has been revoked", d.Delegate)
+	}
+	return verify(d.Delegate, data, sig)
+}
+
+//CheckDelegatedChange makes sure a delegate only changed what it's allowed to between old and updated.
+//Delegates can never touch revocations and revoked delegates can't do anything.
+func CheckDelegatedChange(d Delegation, old, updated User) error {
+	if hasName(old.RevokedDelegates, d.Delegate) || hasName(updated.RevokedDelegates, d.Delegate) {
+		return fmt.Errorf("delegate %s has been revoked", d.Delegate)
+	}
+	if strings.Join(old.RevokedDelegates, ",") != strings.Join(updated.RevokedDelegates, ",") {
+		return fmt.Errorf("delegates can't change revocations")
+	}
+
+	//blank out what each scope allows and whatever is left has to match.
+	o, u := old, updated
+	if d.allows(ScopePosts) {
+		o.LastPost, u.LastPost = "", ""
+	}
+	if d.allows(ScopeFollows) {
+		o.Follows, u.Follows = nil, nil
+		o.Muted, u.Muted = nil, nil
+		o.Blocked, u.Blocked = nil, nil
+	}
+	if len(d.Scopes) == 0 {
+		return nil
+	}
+	if !sameUser(o, u) {
+		return fmt.Errorf("delegate %s scoped to %v changed more than that", d.Delegate, d.Scopes)
+	}
+	return nil
+}
+
+func sameUser(a, b User) bool {
+	ja, erra := json.Marshal(a)
+	jb, errb := json.Marshal(b)
+	return erra == nil && errb == nil && bytes.Equal(ja, jb)
+}
@@ -0,0 +1,166 @@
+package zebu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestDelegatedSigning(t *testing.T) {
+	owner, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownerAddr := crypto.PubkeyToAddress(owner.PublicKey).Hex()
+	sessionAddr := crypto.PubkeyToAddress(session.PublicKey).Hex()
+
+	d, err := NewDelegation(owner, sessionAddr, time.Now().Add(time.Hour), ScopePosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unr := UserNameRecord{CID: "Qmd8fBSQeJ2MNkALQiLCFihymSAM4o7i13VnEJSAofAZWb", Sequence: 2, PubKey: ownerAddr}
+	if err := unr.SignDelegated(session, d); err != nil {
+		t.Fatal(err)
+	}
+	if !unr.Validate() {
+		t.Fatalf("delegated record didn't validate")
+	}
+
+	//someone else's key can't use the delegation
+	stranger, _ := crypto.GenerateKey()
+	stolen := UserNameRecord{CID: unr.CID, Sequence: 3, PubKey: ownerAddr}
+	if err := stolen.SignDelegated(stranger, d); err != nil {
+		t.Fatal(err)
+	}
+	if stolen.Validate() {
+		t.Fatalf("stranger validated with someone elses delegation")
+	}
+
+	//delegation for another account doesn't carry over
+	other := UserNameRecord{CID: unr.CID, Sequence: 3, PubKey: account}
+	if err := other.SignDelegated(session, d); err != nil {
+		t.Fatal(err)
+	}
+	if other.Validate() {
+		t.Fatalf("delegation validated for the wrong owner")
+	}
+
+	expired, err := NewDelegation(owner, sessionAddr, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	late := UserNameRecord{CID: unr.CID, Sequence: 3, PubKey: ownerAddr}
+	if err := late.SignDelegated(session, expired); err != nil {
+		t.Fatal(err)
+	}
+	if late.Validate() {
+		t.Fatalf("expired delegation validated")
+	}
+
+	//widening the scopes breaks the owners signature
+	widened := unr
+	wd := d
+	wd.Scopes = nil
+	widened.Delegation = &wd
+	if widened.Validate() {
+		t.Fatalf("tampered delegation validated")
+	}
+}
+
+func TestDelegatedChangeScopes(t *testing.T) {
+	posts := Delegation{Delegate: "0xSESSION", Scopes: []string{ScopePosts}}
+	follows := Delegation{Delegate: "0xSESSION", Scopes: []string{ScopeFollows}}
+	anything := Delegation{Delegate: "0xSESSION"}
+
+	old := User{PublicName: "0xA11CE", DisplayName: "alice.northbriton.net", LastPost: "a", Follows: []string{"bob"}}
+	posted := old
+	posted.LastPost = "b"
+	followed := old
+	followed.Follows = []string{"bob", "carol"}
+	renamed := old
+	renamed.DisplayName = "mallory.northbriton.net"
+	revoked := old
+	revoked.RevokedDelegates = []string{"0xOTHER"}
+	selfrevoked := old
+	selfrevoked.RevokedDelegates = []string{"0xSESSION"}
+
+	cases := []struct {
+		name    string
+		d       Delegation
+		old     User
+		updated User
+		ok      bool
+	}{
+		{"post with posts scope", posts, old, posted, true},
+		{"follow with posts scope", posts, old, followed, false},
+		{"follow with follows scope", follows, old, followed, true},
+		{"post with follows scope", follows, old, posted, false},
+		{"rename with posts scope", posts, old, renamed, false},
+		{"rename unscoped", anything, old, renamed, true},
+		{"revoke unscoped", anything, old, revoked, false},
+		{"post after revoked", anything, selfrevoked, selfrevoked, false},
+	}
+	for _, c := range cases {
+		err := CheckDelegatedChange(c.d, c.old, c.updated)
+		if (err == nil) != c.ok {
+			t.Fatalf("%s: expected ok=%v got %v", c.name, c.ok, err)
+		}
+	}
+}
+
+func TestDelegatedPostSignature(t *testing.T) {
+	owner, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionAddr := crypto.PubkeyToAddress(session.PublicKey).Hex()
+	user := User{PublicName: crypto.PubkeyToAddress(owner.PublicKey).Hex()}
+	now := time.Now().UTC()
+
+	sign := func(d Delegation, created time.Time) Post {
+		p := Post{Content: "QmP95DscnxiNzzDJ7wcivJNKe1xNCRzxh8Td9Uo5focKpZ", Created: created, Author: user.PublicKey(), Delegation: &d}
+		if err := p.Sign(session); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	posts, err := NewDelegation(owner, sessionAddr, now.Add(time.Hour), ScopePosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follows, err := NewDelegation(owner, sessionAddr, now.Add(time.Hour), ScopeFollows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := sign(posts, now).SignatureStatusFor(user); status != SignatureValid {
+		t.Fatalf("session key post should be valid got %s", status)
+	}
+	//the session is long over but it was fine when this was posted.
+	if status := sign(posts, now.Add(-time.Minute)).SignatureStatusFor(user); status != SignatureValid {
+		t.Fatalf("post from before expiry should stay valid got %s", status)
+	}
+	if status := sign(posts, now.Add(2*time.Hour)).SignatureStatusFor(user); status != SignatureMismatch {
+		t.Fatalf("post after expiry shouldn't be valid got %s", status)
+	}
+	if status := sign(follows, now).SignatureStatusFor(user); status != SignatureMismatch {
+		t.Fatalf("follows only session can't sign posts got %s", status)
+	}
+	revoked := user
+	revoked.RevokedDelegates = []string{sessionAddr}
+	if status := sign(posts, now).SignatureStatusFor(revoked); status != SignatureMismatch {
+		t.Fatalf("revoked session shouldn't be valid got %s", status)
+	}
+	if status := sign(posts, now).SignatureStatusFor(User{PublicName: account}); status != SignatureMismatch {
+		t.Fatalf("delegation is for someone else got %s", status)
+	}
+}
@@ -0,0 +1,88 @@
+package zebu
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+//Signing schemes a UserNameRecord can use. The scheme travels with the record so old signatures keep validating.
+const (
+	//personal_sign over the json of the record. Breaks if fields move or get added.
+	LegacyScheme = ""
+	//eth_signTypedData_v4 over the fields below scoped to the zebu domain.
+	EIP712Scheme = "eip712-v1"
+	//eip712-v1 plus Previous and Merged so forks can be detected and resolved.
+	EIP712ChainScheme = "eip712-v2"
+)
+
+//domain separator so a zebu signature can't be replayed as something else.
+var zebuDomain = apitypes.TypedDataDomain{
+	Name:    "zebu",
+	Version: "1",
+}
+
+//adding a field here means a new scheme version. Old records have to keep hashing the same.
+var recordTypes = apitypes.Types{
+	"EIP712Domain": {
+		{Name: "name", Type: "string"},
+		{Name: "version", Type: "string"},
+	},
+	"UserNameRecord": {
+		{Name: "CID", Type: "string"},
+		{Name: "Sequence", Type: "uint64"},
+		{Name: "PubKey", Type: "string"},
+	},
+}
+
+var chainedRecordTypes = apitypes.Types{
+	"EIP712Domain": recordTypes["EIP712Domain"],
+	"UserNameRecord": {
+		{Name: "CID", Type: "string"},
+		{Name: "Sequence", Type: "uint64"},
+		{Name: "PubKey", Type: "string"},
+		{Name: "Previous", Type: "string"},
+		{Name: "Merged", Type: "string"},
+	},
+}
+
+//TypedData is what a wallet is asked to sign for EIP712Scheme or EIP712ChainScheme.
+func (unr UserNameRecord) TypedData() apitypes.TypedData {
+	td := apitypes.TypedData{
+		Types:       recordTypes,
+		PrimaryType: "UserNameRecord",
+		Domain:      zebuDomain,
+		Message: apitypes.TypedDataMessage{
+			"CID":      unr.CID,
+			"Sequence": strconv.FormatUint(unr.Sequence, 10), //strings so we don't lose precision through float64
+			"PubKey":   unr.PubKey,
+		},
+	}
+	if unr.Scheme == EIP712ChainScheme {
+		td.Types = chainedRecordTypes
+		td.Message["Previous"] = unr.Previous
+		td.Message["Merged"] = unr.Merged
+	}
+	return td
+}
+
+//TypedDataHash is the digest behind TypedData. Session keys have no wallet to do typed data so they sign this as is.
+func (unr UserNameRecord) TypedDataHash() ([]byte, error) {
+	return typedDataHash(unr.TypedData())
+}
+
+//same as signer/core SignTypedData minus the ui.
+func typedDataHash(td apitypes.TypedData) ([]byte, error) {
+	domainSeparator, err := td.HashStruct("EIP712Domain", td.Domain.Map())
+	if err != nil {
+		return nil, fmt.Errorf("couldn't hash domain %w", err)
+	}
+	messageHash, err := td.HashStruct(td.PrimaryType, td.Message)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't hash %s %w", td.PrimaryType, err)
+	}
+	rawData := []byte(fmt.Sprintf("\x19\x01%s%s", string(domainSeparator), string(messageHash)))
+	return crypto.Keccak256(rawData), nil
+}
@@ -0,0 +1,196 @@
+package zebu
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/wealdtech/go-ens/v3"
+)
+
+//ErrEnsNotFound is a name with no address or an address with no name. It's an answer not a failure so it gets cached.
+var ErrEnsNotFound = errors.New("not in ens")
+
+//text records we show on profiles. zebu is a key the name's owner wants to post as
+//if it isn't their ethereum address, like an ed25519 or libp2p key.
+var EnsProfileKeys = []string{"avatar", "url", "description", "zebu"}
+
+//EnsClient reads ENS over one long lived connection instead of dialing for every name.
+//Anything that can call contracts will do, ethclient in prod and a simulated chain in tests.
+type EnsClient struct {
+	backend bind.ContractBackend
+	names   *ResolverCache //reverse lookups, every raw address on a page asks
+}
+
+func NewEnsClient(backend bind.ContractBackend) *EnsClient {
+	e := &EnsClient{backend: backend}
+	e.names = NewResolverCache(e.lookupName)
+	return e
+}
+
+func DialEns(endpoint string) (*EnsClient, error) {
+	client, err := ethclient.Dial(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return NewEnsClient(client), nil
+}
+
+func (e *EnsClient) resolver(name string) (*ens.Resolver, error) {
+	resolver, err := ens.NewResolver(e.backend, name)
+	if err != nil {
+		//go-ens only tells us the name isn't there in words.
+		switch err.Error() {
+		case "unregistered name", "no resolver":
+			return nil, fmt.Errorf("%w, %s is an %s", ErrEnsNotFound, name, err)
+		}
+		return nil, err
+	}
+	return resolver, nil
+}
+
+//Address is the ethereum address name points at.
+func (e *EnsClient) Address(name string) (string, error) {
+	resolver, err := e.resolver(name)
+	if err != nil {
+		return "", err
+	}
+	addr, err := resolver.Address()
+	if err != nil {
+		return "", err
+	}
+	if addr == ens.UnknownAddress {
+		return "", fmt.Errorf("%w, %s has no address", ErrEnsNotFound, name)
+	}
+	return addr.Hex(), nil
+}
+
+//Account is who name posts as. Their zebu text record if it's a key we can verify, otherwise their address.
+//Plenty of resolvers don't do text records at all so not being able to read one just means using the address.
+func (e *EnsClient) Account(name string) (string, error) {
+	texts, err := e.Text(name, "zebu")
+	if err != nil {
+		if !errors.Is(err, ErrEnsNotFound) {
+			log.Printf("couldn't read zebu record for %s, using its address, %s", name, err)
+		}
+		return e.Address(name)
+	}
+	if key := strings.TrimSpace(texts["zebu"]); key != "" && IsPublicKey(key) {
+		return key, nil
+	}
+	return e.Address(name)
+}
+
+//Text reads text records off name. Missing ones come back empty.
+func (e *EnsClient) Text(name string, keys ...string) (map[string]string, error) {
+	resolver, err := e.resolver(name)
+	if err != nil {
+		return nil, err
+	}
+	texts := map[string]string{}
+	for _, k := range keys {
+		text, err := resolver.Text(k)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read %s for %s, %w", k, name, err)
+		}
+		texts[k] = text
+	}
+	return texts, nil
+}
+
+//Name is the primary name address has set for itself, cached like forward lookups.
+func (e *EnsClient) Name(address string) (string, error) {
+	return e.names.Resolve(address)
+}
+
+//anyone can set any reverse record so it only counts if the name points back at the address.
+func (e *EnsClient) lookupName(address string) (string, time.Duration, error) {
+	if !common.IsHexAddress(address) {
+		return "", 0, fmt.Errorf("%s isn't an ethereum address", address)
+	}
+	addr := common.HexToAddress(address)
+	name, err := ens.ReverseResolve(e.backend, addr)
+	if err != nil {
+		//no reverse resolver or an empty name both just mean they haven't set one.
+		switch err.Error() {
+		case "no resolution", "not a resolver":
+			return "", ensTTL, fmt.Errorf("%w, %s has no name", ErrEnsNotFound, address)
+		}
+		return "", 0, err
+	}
+	forward, err := e.Address(name)
+	if errors.Is(err, ErrEnsNotFound) || (err == nil && forward != addr.Hex()) {
+		return "", ensTTL, fmt.Errorf("%w, %s claims %s but it doesn't point back", ErrEnsNotFound, address, name)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return name, ensTTL, nil
+}
+
+//ENS names don't come with a ttl and owners don't change their address often.
+const ensTTL = 10 * time.Minute
+
+//EnsResolver resolves .eth names with client. Without a client (no ETHENDPOINT) .eth names fail
+//rather than going on down the chain to dns.
+type EnsResolver struct {
+	client   *EnsClient
+	accounts *ResolverCache
+}
+
+func NewEnsResolver(client *EnsClient) *EnsResolver {
+	e := &EnsResolver{client: client}
+	e.accounts = NewResolverCache(e.lookup)
+	return e
+}
+
+func (e *EnsResolver) Name() string { return "ens" }
+
+func (e *EnsResolver) Handles(id string) bool {
+	return strings.HasSuffix(strings.ToLower(id), ".eth")
+}
+
+func (e *EnsResolver) Resolve(id string) (string, error) {
+	return e.accounts.Resolve(id)
+}
+
+func (e *EnsResolver) Forget(name string) {
+	e.accounts.Forget(name)
+}
+
+func (e *EnsResolver) lookup(name string) (string, time.Duration, error) {
+	if e.client == nil {
+		return "", 0, NoEthEndpoint
+	}
+	key, err := e.client.Account(name)
+	if errors.Is(err, ErrEnsNotFound) {
+		return "", ensTTL, err
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return key, ensTTL, nil
+}
+
+//NameOf is the verified primary ens name of an ethereum address.
+func (e *EnsResolver) NameOf(key string) (string, error) {
+	if e.client == nil {
+		return "", NoEthEndpoint
+	}
+	if !strings.HasPrefix(key, EthereumPrefix) {
+		return "", fmt.Errorf("%w, %s isn't an ethereum address", ErrEnsNotFound, key)
+	}
+	return e.client.Name(key)
+}
+
+func (e *EnsResolver) Text(name string, keys ...string) (map[string]string, error) {
+	if e.client == nil {
+		return nil, NoEthEndpoint
+	}
+	return e.client.Text(name, keys...)
+}
@@ -0,0 +1,215 @@
+package zebu
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/wealdtech/go-ens/v3"
+	"github.com/wealdtech/go-ens/v3/contracts/registry"
+	"github.com/wealdtech/go-ens/v3/contracts/resolver"
+)
+
+//ensRecords answers go-ens's calls to the registry and resolvers from maps. Calls are decoded and replies
+//encoded with go-ens's own contract abis so everything between EnsClient and the wire is the real thing.
+//Only reads are implemented, anything else panics on the nil embedded backend.
+type ensRecords struct {
+	bind.ContractBackend
+	t         *testing.T
+	registry  common.Address
+	contracts struct{ registry, resolver abi.ABI }
+	owners    map[[32]byte]common.Address
+	resolvers map[[32]byte]common.Address
+	addrs     map[[32]byte]common.Address
+	texts     map[[32]byte]map[string]string
+	names     map[[32]byte]string //reverse records
+	//deployed resolvers and whether they implement text(). Old ones don't.
+	deployed map[common.Address]bool
+}
+
+func newEnsRecords(t *testing.T) *ensRecords {
+	registryAddr, err := ens.RegistryContractAddress(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parse := func(contractABI string) abi.ABI {
+		parsed, err := abi.JSON(strings.NewReader(contractABI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	records := &ensRecords{
+		t:         t,
+		registry:  registryAddr,
+		owners:    map[[32]byte]common.Address{},
+		resolvers: map[[32]byte]common.Address{},
+		addrs:     map[[32]byte]common.Address{},
+		texts:     map[[32]byte]map[string]string{},
+		names:     map[[32]byte]string{},
+		deployed:  map[common.Address]bool{},
+	}
+	records.contracts.registry = parse(registry.ContractABI)
+	records.contracts.resolver = parse(resolver.ContractABI)
+	return records
+}
+
+func (r *ensRecords) CodeAt(ctx context.Context, contract common.Address, block *big.Int) ([]byte, error) {
+	if contract == r.registry || r.hasCode(contract) {
+		return []byte{0xfe}, nil
+	}
+	return nil, nil
+}
+
+func (r *ensRecords) hasCode(contract common.Address) bool {
+	_, found := r.deployed[contract]
+	return found
+}
+
+//nothing there comes back empty like the evm and bind turns that into no contract code.
+func (r *ensRecords) CallContract(ctx context.Context, call ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	contract := r.contracts.registry
+	if *call.To != r.registry {
+		if !r.hasCode(*call.To) {
+			return nil, nil
+		}
+		contract = r.contracts.resolver
+	}
+	method, err := contract.MethodById(call.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	args, err := method.Inputs.Unpack(call.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	node := args[0].([32]byte)
+	var reply interface{}
+	switch {
+	case *call.To == r.registry && method.Name == "owner":
+		reply = r.owners[node]
+	case *call.To == r.registry && method.Name == "resolver":
+		reply = r.resolvers[node]
+	case method.Name == "addr" && len(args) == 1:
+		reply = r.addrs[node]
+	case method.Name == "name":
+		reply = r.names[node]
+	case method.Name == "text" && r.deployed[*call.To]:
+		reply = r.texts[node][args[1].(string)]
+	default:
+		return nil, errors.New("execution reverted")
+	}
+	return method.Outputs.Pack(reply)
+}
+
+func (r *ensRecords) node(name string) [32]byte {
+	hash, err := ens.NameHash(name)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return hash
+}
+
+//register gives name to owner with its records on resolverAddr.
+func (r *ensRecords) register(name string, owner, resolverAddr common.Address, texts map[string]string) {
+	node := r.node(name)
+	r.owners[node] = owner
+	r.resolvers[node] = resolverAddr
+	r.addrs[node] = owner
+	r.texts[node] = texts
+}
+
+//claim sets addr's reverse record to name, which anyone can do for themselves.
+func (r *ensRecords) claim(addr common.Address, name string, resolverAddr common.Address) {
+	node := r.node(strings.ToLower(addr.Hex()[2:]) + ".addr.reverse")
+	r.owners[node] = addr
+	r.resolvers[node] = resolverAddr
+	r.names[node] = name
+}
+
+func TestEnsClient(t *testing.T) {
+	records := newEnsRecords(t)
+	public := common.HexToAddress("0x4976fb03C32e5B8cfe2b6cCB31c09Ba78EBaBa41")
+	old := common.HexToAddress("0x1da022710dF5002339274AaDEe8D58218e9D6AB5")
+	records.deployed[public] = true
+	records.deployed[old] = false
+	alice := common.HexToAddress("0x5AEDA56215b167893e80B4fE645BA6d5Bab767DE")
+	carol := common.HexToAddress("0x00000000000000000000000000000000000ca201")
+	dave := common.HexToAddress("0x00000000000000000000000000000000000da7e0")
+	mallory := common.HexToAddress("0x000000000000000000000000000000000000bad1")
+
+	records.register("alice.eth", alice, public, map[string]string{"avatar": "ipfs://QmAvatar", "url": "https://alice.example"})
+	records.register("carol.eth", carol, public, map[string]string{"zebu": "ed25519:46bcf8641af0691bdcc8d8bb8d249ad289ec17ccb9ba042728fa22d29f58022d"})
+	records.register("dave.eth", dave, old, nil)
+	records.claim(alice, "alice.eth", public)
+	//anyone can claim a name in their reverse record.
+	records.claim(mallory, "alice.eth", public)
+
+	client := NewEnsClient(records)
+
+	if addr, err := client.Address("alice.eth"); err != nil || addr != alice.Hex() {
+		t.Fatalf("alice.eth resolved to %s, %v", addr, err)
+	}
+	if _, err := client.Address("nobody.eth"); !errors.Is(err, ErrEnsNotFound) {
+		t.Fatalf("expected nobody.eth not to be found got %v", err)
+	}
+	if key, err := client.Account("carol.eth"); err != nil || !strings.HasPrefix(key, Ed25519Prefix) {
+		t.Fatalf("carol's zebu record should win over her address got %s, %v", key, err)
+	}
+	if key, err := client.Account("alice.eth"); err != nil || key != alice.Hex() {
+		t.Fatalf("alice has no zebu record so should be her address got %s, %v", key, err)
+	}
+	if key, err := client.Account("dave.eth"); err != nil || key != dave.Hex() {
+		t.Fatalf("dave's resolver can't do text records so should be his address got %s, %v", key, err)
+	}
+	if _, err := client.Account("nobody.eth"); !errors.Is(err, ErrEnsNotFound) {
+		t.Fatalf("expected nobody.eth not to be found got %v", err)
+	}
+
+	texts, err := client.Text("alice.eth", EnsProfileKeys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if texts["avatar"] != "ipfs://QmAvatar" || texts["url"] != "https://alice.example" || texts["description"] != "" {
+		t.Fatalf("bad text records %v", texts)
+	}
+
+	if name, err := client.Name(strings.ToLower(alice.Hex())); err != nil || name != "alice.eth" {
+		t.Fatalf("alice should reverse to alice.eth got %s, %v", name, err)
+	}
+	if _, err := client.Name(mallory.Hex()); !errors.Is(err, ErrEnsNotFound) {
+		t.Fatalf("mallory's reverse record doesn't point back so shouldn't count got %v", err)
+	}
+	if _, err := client.Name(carol.Hex()); !errors.Is(err, ErrEnsNotFound) {
+		t.Fatalf("carol has no reverse record got %v", err)
+	}
+}
+
+//the real contracts on mainnet, if there's an endpoint to reach them.
+func TestEnsClientMainnet(t *testing.T) {
+	endpoint := os.Getenv("ETHENDPOINT")
+	if endpoint == "" {
+		t.Skip("ETHENDPOINT not defined")
+	}
+	client, err := DialEns(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vitalik := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+	if addr, err := client.Address("vitalik.eth"); err != nil || addr != vitalik {
+		t.Fatalf("vitalik.eth resolved to %s, %v", addr, err)
+	}
+	if name, err := client.Name(vitalik); err != nil || name != "vitalik.eth" {
+		t.Fatalf("expected vitalik.eth got %s, %v", name, err)
+	}
+	if _, err := client.Text("vitalik.eth", EnsProfileKeys...); err != nil {
+		t.Fatalf("couldn't read text records, %v", err)
+	}
+}
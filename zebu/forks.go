@@ -0,0 +1,78 @@
+package zebu
+
+//MergePost joins another branch of the authors chain back in. Target is the head of the other branch.
+const MergePost = "merge"
+
+//Fork is a record that conflicts with the one we're using for the same key.
+//Either two devices published the same sequence or someone built on a record we never had.
+type Fork struct {
+	Record UserNameRecord
+	User   User
+}
+
+//conflicts is true if unr can't just replace existing.
+func conflicts(existing, unr UserNameRecord) bool {
+	if existing.CID == "" || existing.CID == unr.CID {
+		return false
+	}
+	if unr.Sequence == existing.Sequence {
+		return true
+	}
+	//we can only tell for the very next record. A gap just means we missed some.
+	return unr.Sequence == existing.Sequence+1 && unr.Previous != "" && unr.Previous != existing.CID
+}
+
+//forks by public key. Not persisted since peers keep republishing so we'll see them again.
+type forks map[string][]Fork
+
+func (f forks) has(pubkey, cid string) bool {
+	for _, fork := range f[pubkey] {
+		if fork.Record.CID == cid {
+			return true
+		}
+	}
+	return false
+}
+
+func (f forks) add(fork Fork) {
+	if f.has(fork.Record.PubKey, fork.Record.CID) {
+		return
+	}
+	f[fork.Record.PubKey] = append(f[fork.Record.PubKey], fork)
+}
+
+//resolve forgets forks that unr merged or built on.
+func (f forks) resolve(unr UserNameRecord) {
+	kept := []Fork{}
+	for _, fork := range f[unr.PubKey] {
+		cid := fork.Record.CID
+		if cid != unr.Merged && cid != unr.Previous && cid != unr.CID {
+			kept = append(kept, fork)
+		}
+	}
+	if len(kept) == 0 {
+		delete(f, unr.PubKey)
+		return
+	}
+	f[unr.PubKey] = kept
+}
+
+//MergeUsers combines two branches of the same user. Lists are unioned and ours wins for everything else.
+//LastPost is left alone since joining the chains takes a MergePost.
+func MergeUsers(ours, theirs User) User {
+	merged := ours
+	for _, f := range theirs.Follows {
+		merged.Follows = addName(merged.Follows, f)
+	}
+	for _, m := range theirs.Muted {
+		merged.Muted = addName(merged.Muted, m)
+	}
+	for _, b := range theirs.Blocked {
+		merged.Blocked = addName(merged.Blocked, b)
+	}
+	//a revocation on either side should stick.
+	for _, r := range theirs.RevokedDelegates {
+		merged.RevokedDelegates = addName(merged.RevokedDelegates, r)
+	}
+	return merged
+}
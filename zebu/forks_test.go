@@ -0,0 +1,134 @@
+package zebu
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/samber/lo"
+)
+
+func TestConflicts(t *testing.T) {
+	head := UserNameRecord{CID: "a", Sequence: 2, PubKey: "0xA11CE"}
+	cases := []struct {
+		name string
+		unr  UserNameRecord
+		want bool
+	}{
+		{"same record", UserNameRecord{CID: "a", Sequence: 2}, false},
+		{"same sequence", UserNameRecord{CID: "b", Sequence: 2}, true},
+		{"built on head", UserNameRecord{CID: "b", Sequence: 3, Previous: "a"}, false},
+		{"built on something else", UserNameRecord{CID: "b", Sequence: 3, Previous: "z"}, true},
+		{"old record without previous", UserNameRecord{CID: "b", Sequence: 3}, false},
+		{"missed some", UserNameRecord{CID: "b", Sequence: 5, Previous: "z"}, false},
+	}
+	for _, c := range cases {
+		if got := conflicts(head, c.unr); got != c.want {
+			t.Errorf("%s: got %v wanted %v", c.name, got, c.want)
+		}
+	}
+	if conflicts(UserNameRecord{}, UserNameRecord{CID: "b", Sequence: 1, Previous: "z"}) {
+		t.Errorf("nothing to conflict with")
+	}
+}
+
+func TestForksResolve(t *testing.T) {
+	f := forks{}
+	f.add(Fork{Record: UserNameRecord{CID: "b", Sequence: 2, PubKey: "0xA11CE"}})
+	f.add(Fork{Record: UserNameRecord{CID: "b", Sequence: 2, PubKey: "0xA11CE"}})
+	f.add(Fork{Record: UserNameRecord{CID: "c", Sequence: 2, PubKey: "0xA11CE"}})
+	if len(f["0xA11CE"]) != 2 {
+		t.Fatalf("expected 2 forks got %v", f["0xA11CE"])
+	}
+	f.resolve(UserNameRecord{CID: "d", Sequence: 3, PubKey: "0xA11CE", Previous: "a", Merged: "b"})
+	if f.has("0xA11CE", "b") || !f.has("0xA11CE", "c") {
+		t.Fatalf("merge should only resolve b %v", f["0xA11CE"])
+	}
+	f.resolve(UserNameRecord{CID: "e", Sequence: 3, PubKey: "0xA11CE", Previous: "c"})
+	if _, found := f["0xA11CE"]; found {
+		t.Fatalf("building on c should resolve it %v", f["0xA11CE"])
+	}
+}
+
+func TestMergeUsers(t *testing.T) {
+	ours := User{PublicName: "0xA11CE", LastPost: "ours", Follows: []string{"bob.eth"}, RevokedDelegates: []string{"0x1"}}
+	theirs := User{PublicName: "0xA11CE", LastPost: "theirs", Follows: []string{"BOB.eth", "carol.eth"}, Muted: []string{"dave.eth"}, RevokedDelegates: []string{"0x2"}}
+	merged := MergeUsers(ours, theirs)
+	if merged.LastPost != "ours" {
+		t.Fatalf("merge shouldn't pick a LastPost")
+	}
+	if len(merged.Follows) != 2 || !merged.Hides("dave.eth") || len(merged.RevokedDelegates) != 2 {
+		t.Fatalf("lists weren't unioned %+v", merged)
+	}
+}
+
+func TestWalkMergedBranches(t *testing.T) {
+	m := newMemBackend()
+	start := time.Now().Add(-time.Hour).UTC()
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	alice := User{PublicName: "0xA11CE"}
+	m.post(t, &alice, Post{Content: "root", Created: at(0)})
+	phone := alice
+	laptop := alice
+	m.post(t, &phone, Post{Content: "phone 1", Created: at(1)})
+	m.post(t, &laptop, Post{Content: "laptop 1", Created: at(2)})
+	m.post(t, &phone, Post{Content: "phone 2", Created: at(3)})
+	m.post(t, &laptop, Post{Content: "laptop 2", Created: at(4)})
+
+	merged := MergeUsers(laptop, phone)
+	m.post(t, &merged, Post{Kind: MergePost, Target: phone.LastPost, Created: at(5)})
+
+	posts := lo.ChannelToSlice(m.GetPosts(context.Background(), merged, 10))
+	got := lo.Map(posts, func(p FetchedPost, _ int) string { return p.Content })
+	want := []string{"laptop 2", "phone 2", "laptop 1", "phone 1", "root"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v wanted %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v wanted %v", got, want)
+		}
+	}
+	for _, p := range posts {
+		if len(p.Violations) != 0 {
+			t.Fatalf("interleaved branches shouldn't look out of order %v", p)
+		}
+	}
+}
+
+func TestChainSchemeSigning(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unr := UserNameRecord{
+		CID:      "Qmd8fBSQeJ2MNkALQiLCFihymSAM4o7i13VnEJSAofAZWb",
+		Sequence: 4,
+		PubKey:   crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		Scheme:   EIP712ChainScheme,
+		Previous: "QmP95DscnxiNzzDJ7wcivJNKe1xNCRzxh8Td9Uo5focKpZ",
+	}
+	if err := unr.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	if !unr.Validate() {
+		t.Fatalf("chained record didn't validate")
+	}
+	unr.Merged = "QmYpdmbS3m677XLjixE6YkeMxCcnAvxmksWiubK4pigiFw"
+	if unr.Validate() {
+		t.Fatalf("Merged isn't covered by the signature")
+	}
+
+	//older schemes don't get to carry them at all.
+	for _, scheme := range []string{LegacyScheme, EIP712Scheme} {
+		unr.Scheme = scheme
+		if err := unr.Sign(key); err != nil {
+			t.Fatal(err)
+		}
+		if unr.Validate() {
+			t.Fatalf("%q record with Previous and Merged validated", scheme)
+		}
+	}
+}
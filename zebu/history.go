@@ -0,0 +1,164 @@
+package zebu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+
+	ipfs "github.com/ipfs/go-ipfs-api"
+)
+
+//mfs layout is /zebu/<pubkey>/current for the record we republish and /zebu/<pubkey>/history/<sequence> for every record we've accepted.
+//before history a users record was just the file /zebu/<pubkey>.
+const mfsFile = 0 //MfsLsEntry.Type for files, directories are 1
+
+func userDir(pubkey string) string {
+	return centraltopic + "/" + pubkey
+}
+
+func currentPath(pubkey string) string {
+	return userDir(pubkey) + "/current"
+}
+
+func historyDir(pubkey string) string {
+	return userDir(pubkey) + "/history"
+}
+
+//zero padded so history lists in order.
+func historyPath(pubkey string, sequence uint64) string {
+	return fmt.Sprintf("%s/%020d", historyDir(pubkey), sequence)
+}
+
+func (b *IpfsBackend) readMfs(ctx context.Context, path string) ([]byte, error) {
+	r, err := b.shell.FilesRead(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+//saveRecord makes data the current record for unr.PubKey and adds it to their history.
+func (b *IpfsBackend) saveRecord(ctx context.Context, unr UserNameRecord, data []byte) error {
+	current := currentPath(unr.PubKey)
+	if err := b.shell.FilesWrite(ctx, current, bytes.NewReader(data), ipfs.FilesWrite.Create(true), ipfs.FilesWrite.Parents(true), ipfs.FilesWrite.Truncate(true)); err != nil {
+		return err
+	}
+	log.Printf("wrote to %s", current)
+	past := historyPath(unr.PubKey, unr.Sequence)
+	if err := b.shell.FilesWrite(ctx, past, bytes.NewReader(data), ipfs.FilesWrite.Create(true), ipfs.FilesWrite.Parents(true), ipfs.FilesWrite.Truncate(true)); err != nil {
+		return fmt.Errorf("couldn't write history %s, %w", past, err)
+	}
+	return nil
+}
+
+//where the old single file goes while its directory is written. One left over means we stopped part way
+//and loadRecords finishes the job.
+const migratingSuffix = ".migrating"
+
+//migrateRecord moves a record from the old single file layout into a user directory. The file has to
+//get out of the way first since the directory has the same name. It's moved not removed so the record
+//survives until the new layout is written.
+func (b *IpfsBackend) migrateRecord(ctx context.Context, name string) error {
+	pubkey := strings.TrimSuffix(name, migratingSuffix)
+	old := userDir(pubkey) + migratingSuffix
+	if name == pubkey {
+		if err := b.shell.FilesMv(ctx, userDir(pubkey), old); err != nil {
+			return err
+		}
+	}
+	data, err := b.readMfs(ctx, old)
+	if err != nil {
+		return err
+	}
+	var unr UserNameRecord
+	if err := json.Unmarshal(data, &unr); err != nil {
+		return err
+	}
+	log.Printf("migrating %s to %s", pubkey, currentPath(pubkey))
+	if err := b.saveRecord(ctx, unr, data); err != nil {
+		return fmt.Errorf("%w, the old record is still at %s", err, old)
+	}
+	return b.shell.FilesRm(ctx, old, true)
+}
+
+func (b *IpfsBackend) History(ctx context.Context, pubkey string) ([]UserNameRecord, error) {
+	entries, err := b.shell.FilesLs(ctx, historyDir(pubkey))
+	if err != nil {
+		return nil, fmt.Errorf("no history for %s, %w", pubkey, err)
+	}
+	records := []UserNameRecord{}
+	for _, e := range entries {
+		data, err := b.readMfs(ctx, historyDir(pubkey)+"/"+e.Name)
+		if err != nil {
+			log.Printf("couldn't read history %s for %s, %s", e.Name, pubkey, err)
+			continue
+		}
+		var unr UserNameRecord
+		if err := json.Unmarshal(data, &unr); err != nil {
+			log.Printf("bad history %s for %s, %s", e.Name, pubkey, err)
+			continue
+		}
+		records = append(records, unr)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Sequence > records[j].Sequence })
+	return records, nil
+}
+
+//ReadUser reads the user document a record points at.
+func ReadUser(ctx context.Context, b ContentBackend, cid string) (User, error) {
+	var user User
+	r, err := b.Cat(ctx, cid)
+	if err != nil {
+		return user, err
+	}
+	defer r.Close()
+	err = json.NewDecoder(r).Decode(&user)
+	return user, err
+}
+
+//DiffUsers describes what changed between two versions of a user for people.
+func DiffUsers(old, updated User) []string {
+	changes := []string{}
+	if old.DisplayName != updated.DisplayName {
+		changes = append(changes, fmt.Sprintf("display name %q to %q", old.DisplayName, updated.DisplayName))
+	}
+	if old.LastPost != updated.LastPost {
+		changes = append(changes, "posted")
+	}
+	if old.Avatar != updated.Avatar {
+		changes = append(changes, "changed avatar")
+	}
+	if old.Bio != updated.Bio {
+		changes = append(changes, "changed bio")
+	}
+	if old.PinnedPost != updated.PinnedPost {
+		changes = append(changes, "changed pinned post")
+	}
+	changes = append(changes, diffList("added link", "removed link", old.Links, updated.Links)...)
+	changes = append(changes, diffList("followed", "unfollowed", old.Follows, updated.Follows)...)
+	changes = append(changes, diffList("muted", "unmuted", old.Muted, updated.Muted)...)
+	changes = append(changes, diffList("blocked", "unblocked", old.Blocked, updated.Blocked)...)
+	changes = append(changes, diffList("revoked delegate", "unrevoked delegate", old.RevokedDelegates, updated.RevokedDelegates)...)
+	return changes
+}
+
+func diffList(added, removed string, old, updated []string) []string {
+	changes := []string{}
+	for _, u := range updated {
+		if !hasName(old, u) {
+			changes = append(changes, added+" "+u)
+		}
+	}
+	for _, o := range old {
+		if !hasName(updated, o) {
+			changes = append(changes, removed+" "+o)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,41 @@
+package zebu
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDiffUsers(t *testing.T) {
+	old := User{PublicName: "0xA11CE", LastPost: "a", Follows: []string{"bob.eth", "carol.eth"}, Muted: []string{"dave.eth"}}
+	updated := User{PublicName: "0xA11CE", LastPost: "b", DisplayName: "alice.eth", Follows: []string{"Bob.eth", "erin.eth"}}
+	got := strings.Join(DiffUsers(old, updated), ",")
+	want := `display name "" to "alice.eth",posted,followed erin.eth,unfollowed carol.eth,unmuted dave.eth`
+	if got != want {
+		t.Fatalf("got %s wanted %s", got, want)
+	}
+	if len(DiffUsers(updated, updated)) != 0 {
+		t.Fatalf("no changes should be empty")
+	}
+}
+
+func TestReadUser(t *testing.T) {
+	m := newMemBackend()
+	alice := User{PublicName: "0xA11CE", Follows: []string{"bob.eth"}}
+	data, err := json.Marshal(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cid := m.put(data)
+	read, err := ReadUser(context.Background(), m, cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameUser(alice, read) {
+		t.Fatalf("got %+v wanted %+v", read, alice)
+	}
+	if _, err := ReadUser(context.Background(), m, "missing"); err == nil {
+		t.Fatalf("expected error for missing user")
+	}
+}
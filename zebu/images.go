@@ -0,0 +1,427 @@
+package zebu
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+//longest side of the copies we make. Feeds show thumbnails and the post page the medium one.
+const (
+	ThumbnailSize = 320
+	MediumSize    = 1280
+	//a tiny file can claim to be enormous. Don't let it.
+	maxPixels = 50 * 1000 * 1000
+)
+
+var ErrNotImage = errors.New("not a jpeg, png, gif or webp")
+
+//ProcessedImage is an upload without its metadata plus smaller copies.
+//Medium and Thumbnail are nil when the original is already small enough.
+type ProcessedImage struct {
+	Format        string
+	Original      []byte
+	Medium        []byte
+	Thumbnail     []byte
+	Width, Height int //after turning it the right way up
+	Blurhash      string
+}
+
+//ProcessImage decodes an upload, turns it the right way up and drops exif/xmp so we don't publish where people live.
+//Jpegs and webps that don't need rotating keep their original pixels, we just cut the metadata out.
+func ProcessImage(data []byte) (ProcessedImage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ProcessedImage{}, ErrNotImage
+	}
+	if config.Width*config.Height > maxPixels {
+		return ProcessedImage{}, fmt.Errorf("%dx%d image is too big", config.Width, config.Height)
+	}
+
+	var img image.Image
+	processed := ProcessedImage{Format: format}
+	switch format {
+	case "jpeg":
+		if img, err = jpeg.Decode(bytes.NewReader(data)); err != nil {
+			return processed, err
+		}
+		orientation := exifOrientation(jpegExif(data))
+		if orientation == 1 {
+			processed.Original, err = stripJPEG(data)
+		} else {
+			img = orient(img, orientation)
+			processed.Original, err = encodeImage(img)
+		}
+	case "png":
+		//re-encoding png is lossless and leaves behind text and exif chunks.
+		if img, err = png.Decode(bytes.NewReader(data)); err != nil {
+			return processed, err
+		}
+		var out bytes.Buffer
+		err = png.Encode(&out, img)
+		processed.Original = out.Bytes()
+	case "gif":
+		//all the frames so animations keep working. Comments and application extensions don't survive.
+		var g *gif.GIF
+		if g, err = gif.DecodeAll(bytes.NewReader(data)); err != nil {
+			return processed, err
+		}
+		if len(g.Image) == 0 {
+			return processed, ErrNotImage
+		}
+		img = g.Image[0]
+		var out bytes.Buffer
+		err = gif.EncodeAll(&out, g)
+		processed.Original = out.Bytes()
+	case "webp":
+		if img, err = webp.Decode(bytes.NewReader(data)); err != nil {
+			return processed, err
+		}
+		//we can read webp but not write it so a rotated one comes out as jpeg or png.
+		orientation := exifOrientation(webpExif(data))
+		if orientation == 1 {
+			processed.Original, err = stripWebP(data)
+		} else {
+			img = orient(img, orientation)
+			processed.Original, err = encodeImage(img)
+		}
+	default:
+		return processed, ErrNotImage
+	}
+	if err != nil {
+		return processed, err
+	}
+
+	processed.Width, processed.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	processed.Blurhash = Blurhash(img)
+
+	medium := shrink(img, MediumSize)
+	if medium != nil {
+		if processed.Medium, err = encodeImage(medium); err != nil {
+			return processed, err
+		}
+		img = medium
+	}
+	if thumb := shrink(img, ThumbnailSize); thumb != nil {
+		if processed.Thumbnail, err = encodeImage(thumb); err != nil {
+			return processed, err
+		}
+	}
+	return processed, nil
+}
+
+//SaveImage processes an upload and adds it and its copies to ipfs. Alt text is up to the caller.
+func SaveImage(ctx context.Context, backend ContentBackend, r io.Reader) (Attachment, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Attachment{}, err
+	}
+	processed, err := ProcessImage(data)
+	if err != nil {
+		return Attachment{}, err
+	}
+	saved := Attachment{
+		Width:    processed.Width,
+		Height:   processed.Height,
+		Size:     int64(len(processed.Original)),
+		Blurhash: processed.Blurhash,
+	}
+	//a rotated jpeg or webp gets re-encoded so sniff rather than trust the format we started with.
+	saved.Type = http.DetectContentType(processed.Original)
+	for _, v := range []struct {
+		data []byte
+		cid  *string
+	}{
+		{processed.Original, &saved.CID},
+		{processed.Medium, &saved.Medium},
+		{processed.Thumbnail, &saved.Thumbnail},
+	} {
+		if v.data == nil {
+			continue
+		}
+		if *v.cid, err = backend.Add(ctx, bytes.NewReader(v.data)); err != nil {
+			return Attachment{}, err
+		}
+	}
+	return saved, nil
+}
+
+//shrink scales img so its longest side is max. Nil if it's already that small.
+func shrink(img image.Image, max int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= max && h <= max {
+		return nil
+	}
+	if w >= h {
+		w, h = max, h*max/w
+	} else {
+		w, h = w*max/h, max
+	}
+	if w == 0 {
+		w = 1
+	}
+	if h == 0 {
+		h = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.BiLinear.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+//jpeg unless there's transparency to keep.
+func encodeImage(img image.Image) ([]byte, error) {
+	var out bytes.Buffer
+	var err error
+	if o, ok := img.(interface{ Opaque() bool }); ok && !o.Opaque() {
+		err = png.Encode(&out, img)
+	} else {
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: 88})
+	}
+	return out.Bytes(), err
+}
+
+//orient applies an exif orientation (1-8) so the pixels are the way up the camera meant.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: //mirrored
+				dx, dy = w-1-x, y
+			case 3: //upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: //mirrored upside down
+				dx, dy = x, h-1-y
+			case 5: //mirrored and on its side
+				dx, dy = y, x
+			case 6: //needs turning clockwise
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8: //needs turning anticlockwise
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
+
+//jpeg segments we keep, everything the decoder needs plus APP0 (jfif) and APP14 (adobe colour transform).
+//All the other APPn (exif, xmp, icc, photoshop...), the JPGn extensions and COM go.
+func keptSegment(marker byte) bool {
+	return marker <= 0xE0 || marker == 0xEE
+}
+
+//walks jpeg segments up to the image data calling f with each marker and payload. False from f stops.
+func jpegSegments(data []byte, f func(marker byte, payload []byte) bool) (scan int, err error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, ErrNotImage
+	}
+	return jpegSegmentsFrom(data, 2, f)
+}
+
+//same as jpegSegments from i on. Stops at a start of scan or the end of the image and says where.
+func jpegSegmentsFrom(data []byte, i int, f func(marker byte, payload []byte) bool) (int, error) {
+	for {
+		for i < len(data) && data[i] == 0xFF && i+1 < len(data) && data[i+1] == 0xFF {
+			i++ //fill bytes
+		}
+		if i+2 > len(data) || data[i] != 0xFF {
+			return 0, fmt.Errorf("bad jpeg marker at %d", i)
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { //start of scan or end of image, there's no segment to read.
+			return i, nil
+		}
+		if i+4 > len(data) {
+			return 0, fmt.Errorf("bad jpeg marker at %d", i)
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 0, fmt.Errorf("truncated jpeg segment at %d", i)
+		}
+		if !f(marker, data[i+4:i+2+length]) {
+			return i, nil
+		}
+		i += 2 + length
+	}
+}
+
+//scanEnd is where the marker after the scan starting at sos is. Entropy coded data escapes its 0xFFs
+//and restart markers belong to the scan so the first other marker ends it.
+func scanEnd(data []byte, sos int) (int, error) {
+	if sos+4 > len(data) {
+		return 0, fmt.Errorf("truncated jpeg scan at %d", sos)
+	}
+	i := sos + 2 + int(binary.BigEndian.Uint16(data[sos+2:]))
+	for ; i+1 < len(data); i++ {
+		if data[i] != 0xFF {
+			continue
+		}
+		if next := data[i+1]; next != 0x00 && next != 0xFF && (next < 0xD0 || next > 0xD7) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("jpeg ends before its end of image marker")
+}
+
+//stripJPEG keeps only the segments in keptSegment and the scans. Anything after the end of image goes too,
+//phones and tools hide all sorts there.
+func stripJPEG(data []byte) ([]byte, error) {
+	out := []byte{0xFF, 0xD8}
+	keep := func(marker byte, payload []byte) bool {
+		if keptSegment(marker) {
+			out = append(out, 0xFF, marker, 0, 0)
+			binary.BigEndian.PutUint16(out[len(out)-2:], uint16(len(payload)+2))
+			out = append(out, payload...)
+		}
+		return true
+	}
+	i, err := jpegSegments(data, keep)
+	//progressive jpegs have more scans with tables and such between them.
+	for err == nil && data[i+1] == 0xDA {
+		var end int
+		if end, err = scanEnd(data, i); err == nil {
+			out = append(out, data[i:end]...)
+			i, err = jpegSegmentsFrom(data, end, keep)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(out, 0xFF, 0xD9), nil
+}
+
+//the tiff block in a jpegs exif segment or nil.
+func jpegExif(data []byte) []byte {
+	var exif []byte
+	jpegSegments(data, func(marker byte, payload []byte) bool {
+		if marker == 0xE1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			exif = payload[6:]
+			return false
+		}
+		return true
+	})
+	return exif
+}
+
+//exifOrientation digs the orientation tag out of the first ifd of a tiff block. 1 (as is) if there isn't one.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < count; e++ {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+//walks the chunks of a webp's riff container.
+func webpChunks(data []byte, f func(fourcc string, chunk []byte)) error {
+	if !isWebP(data) {
+		return ErrNotImage
+	}
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return fmt.Errorf("truncated webp chunk at %d", i)
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size
+		if size < 0 || end > len(data) {
+			return fmt.Errorf("truncated webp chunk at %d", i)
+		}
+		if size%2 == 1 && end < len(data) {
+			end++ //chunks are padded to even sizes
+		}
+		f(string(data[i:i+4]), data[i:end])
+		i = end
+	}
+	return nil
+}
+
+//stripWebP drops the EXIF and XMP chunks and the VP8X flags that say they're there.
+func stripWebP(data []byte) ([]byte, error) {
+	out := []byte("RIFF\x00\x00\x00\x00WEBP")
+	err := webpChunks(data, func(fourcc string, chunk []byte) {
+		switch fourcc {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			start := len(out)
+			out = append(out, chunk...)
+			if len(chunk) > 8 {
+				out[start+8] &^= 0x08 | 0x04
+			}
+		default:
+			out = append(out, chunk...)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
+
+//the tiff block in a webp's EXIF chunk or nil. Some writers keep the jpeg style prefix.
+func webpExif(data []byte) []byte {
+	var exif []byte
+	webpChunks(data, func(fourcc string, chunk []byte) {
+		if fourcc == "EXIF" && exif == nil {
+			exif = bytes.TrimPrefix(chunk[8:], []byte("Exif\x00\x00"))
+		}
+	})
+	return exif
+}
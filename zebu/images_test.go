@@ -0,0 +1,285 @@
+package zebu
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+//halves returns a w x h image red on the left and blue on the right.
+func halves(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	return img
+}
+
+//an APP1 segment with a gps looking string and the given orientation.
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = append(tiff, 1, 0) //one entry
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], 0x0112)
+	binary.LittleEndian.PutUint16(entry[2:], 3) //short
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, []byte("GPS 51.5007N 0.1246W")...)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+func withExif(t *testing.T, img image.Image, orientation uint16) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	return append(append([]byte{0xFF, 0xD8}, exifSegment(orientation)...), data[2:]...)
+}
+
+func isRed(c color.Color) bool {
+	r, _, b, _ := c.RGBA()
+	return r > 0xc000 && b < 0x4000
+}
+
+func TestProcessJPEGRotates(t *testing.T) {
+	data := withExif(t, halves(40, 20), 6)
+	if exifOrientation(jpegExif(data)) != 6 {
+		t.Fatalf("didn't find orientation")
+	}
+	processed, err := ProcessImage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(processed.Original, []byte("Exif")) || bytes.Contains(processed.Original, []byte("GPS")) {
+		t.Fatalf("exif survived")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(processed.Original))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 20 || img.Bounds().Dy() != 40 {
+		t.Fatalf("expected 20x40 got %v", img.Bounds())
+	}
+	//turned clockwise the left half is now on top.
+	if !isRed(img.At(10, 5)) || isRed(img.At(10, 35)) {
+		t.Fatalf("rotated the wrong way")
+	}
+	if processed.Medium != nil || processed.Thumbnail != nil {
+		t.Fatalf("small image shouldn't have copies")
+	}
+}
+
+func TestProcessJPEGStripsWithoutReencoding(t *testing.T) {
+	data := withExif(t, halves(40, 20), 1)
+	processed, err := ProcessImage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(processed.Original, []byte("GPS")) {
+		t.Fatalf("exif survived")
+	}
+	//same scan data just less header.
+	if len(processed.Original) != len(data)-len(exifSegment(1)) || !bytes.HasSuffix(data, processed.Original[2:]) {
+		t.Fatalf("expected only the exif segment to go")
+	}
+}
+
+func TestStripJPEGKeepsOnlyWhatDecodes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, halves(40, 20), nil); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	segment := func(marker byte, payload string) []byte {
+		seg := []byte{0xFF, marker, 0, 0}
+		binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+		return append(seg, payload...)
+	}
+	jfif := segment(0xE0, "JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")
+	adobe := segment(0xEE, "Adobe\x00\x64\x00\x00\x00\x00\x01")
+	data := []byte{0xFF, 0xD8}
+	for _, seg := range [][]byte{
+		jfif,
+		segment(0xE2, "ICC_PROFILE\x00\x01\x01made on alice's laptop"),
+		segment(0xED, "Photoshop 3.0\x008BIM at home"),
+		adobe,
+		segment(0xFE, "shot at home"),
+	} {
+		data = append(data, seg...)
+	}
+	scan := encoded[2 : len(encoded)-2]
+	data = append(data, scan...)
+	//segments can come after the scan too.
+	data = append(data, segment(0xFE, "still at home")...)
+	data = append(data, 0xFF, 0xD9)
+	data = append(data, "trailing secrets at home"...)
+
+	stripped, err := stripJPEG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stripped, []byte("home")) || bytes.Contains(stripped, []byte("alice")) {
+		t.Fatalf("metadata survived")
+	}
+	want := append(append(append([]byte{0xFF, 0xD8}, jfif...), adobe...), encoded[2:]...)
+	if !bytes.Equal(stripped, want) {
+		t.Fatalf("expected jfif, adobe and the image and nothing else")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stripJPEG(data[:len(data)-30]); err == nil {
+		t.Fatalf("expected a jpeg with no end to fail")
+	}
+}
+
+func TestProcessPNGVariants(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, halves(2000, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	//slip a text chunk in after IHDR.
+	text := []byte("tEXtLocation\x00home")
+	chunk := make([]byte, 4)
+	binary.BigEndian.PutUint32(chunk, uint32(len(text)-4))
+	chunk = append(chunk, text...)
+	chunk = append(chunk, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(chunk[len(chunk)-4:], crc32.ChecksumIEEE(text))
+	data = append(append(append([]byte{}, data[:33]...), chunk...), data[33:]...)
+
+	processed, err := ProcessImage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed.Format != "png" || bytes.Contains(processed.Original, []byte("Location")) {
+		t.Fatalf("text chunk survived")
+	}
+	for _, v := range []struct {
+		data []byte
+		w, h int
+	}{{processed.Medium, MediumSize, MediumSize / 2}, {processed.Thumbnail, ThumbnailSize, ThumbnailSize / 2}} {
+		config, _, err := image.DecodeConfig(bytes.NewReader(v.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Width != v.w || config.Height != v.h {
+			t.Fatalf("expected %dx%d got %dx%d", v.w, v.h, config.Width, config.Height)
+		}
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	if _, err := ProcessImage([]byte("<svg onload=alert(1)>")); err != ErrNotImage {
+		t.Fatalf("expected ErrNotImage got %v", err)
+	}
+	//a header claiming to be huge shouldn't get decoded.
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 100000)
+	binary.BigEndian.PutUint32(data[20:], 100000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	if _, err := ProcessImage(data); err == nil || err == ErrNotImage {
+		t.Fatalf("expected too big got %v", err)
+	}
+}
+
+func TestStripWebP(t *testing.T) {
+	chunk := func(fourcc string, data []byte) []byte {
+		c := append([]byte(fourcc), 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(c[4:], uint32(len(data)))
+		c = append(c, data...)
+		if len(data)%2 == 1 {
+			c = append(c, 0)
+		}
+		return c
+	}
+	var body []byte
+	body = append(body, chunk("VP8X", []byte{0x08 | 0x04 | 0x10, 0, 0, 0, 0, 0, 0, 0, 0, 0})...)
+	body = append(body, chunk("VP8L", []byte{1, 2, 3})...)
+	body = append(body, chunk("EXIF", exifSegment(6)[10:])...)
+	body = append(body, chunk("XMP ", []byte("<x:xmpmeta>home</x:xmpmeta>"))...)
+	data := append([]byte("RIFF\x00\x00\x00\x00WEBP"), body...)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+
+	if exifOrientation(webpExif(data)) != 6 {
+		t.Fatalf("didn't find orientation")
+	}
+	stripped, err := stripWebP(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stripped, []byte("GPS")) || bytes.Contains(stripped, []byte("home")) {
+		t.Fatalf("metadata survived")
+	}
+	if stripped[20] != 0x10 {
+		t.Fatalf("expected only the alpha flag left got %x", stripped[20])
+	}
+	if int(binary.LittleEndian.Uint32(stripped[4:])) != len(stripped)-8 {
+		t.Fatalf("riff size wasn't updated")
+	}
+	if !bytes.Contains(stripped, chunk("VP8L", []byte{1, 2, 3})) {
+		t.Fatalf("lost the image data")
+	}
+}
+
+func TestMedia(t *testing.T) {
+	legacy := Post{Images: []string{"QmOld"}}
+	if got := legacy.Media(); len(got) != 1 || got[0] != (Attachment{CID: "QmOld", Medium: "QmOld", Thumbnail: "QmOld"}) {
+		t.Fatalf("got %v", got)
+	}
+	p := Post{
+		Images:      []string{"QmNew"},
+		Attachments: []Attachment{{CID: "QmNew", Type: "image/png", Alt: "a zebra", Thumbnail: "QmNewThumb"}},
+	}
+	want := Attachment{CID: "QmNew", Type: "image/png", Alt: "a zebra", Medium: "QmNew", Thumbnail: "QmNewThumb"}
+	if got := p.Media(); len(got) != 1 || got[0] != want {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestBlurhash(t *testing.T) {
+	solid := image.NewRGBA(image.Rect(0, 0, 50, 50))
+	for i := range solid.Pix {
+		solid.Pix[i] = 255
+	}
+	//L is 4x3 components and TSUA is the average colour, white.
+	if got := Blurhash(solid); len(got) != 28 || got[0] != 'L' || got[2:6] != "TSUA" {
+		t.Fatalf("got %s", got)
+	}
+	if got := Blurhash(halves(300, 200)); len(got) != 28 || got == Blurhash(solid) {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestSaveImage(t *testing.T) {
+	backend := newMemBackend()
+	saved, err := SaveImage(context.Background(), backend, bytes.NewReader(withExif(t, halves(2000, 100), 6)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Type != "image/jpeg" || saved.Width != 100 || saved.Height != 2000 || saved.Blurhash == "" {
+		t.Fatalf("got %+v", saved)
+	}
+	if saved.CID == "" || saved.Medium == "" || saved.Thumbnail == "" {
+		t.Fatalf("missing copies %+v", saved)
+	}
+}
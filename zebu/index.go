@@ -0,0 +1,220 @@
+package zebu
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//PostIndex walks the chains of every user we know about and remembers things posts can't tell you about themselves.
+//like who replied to them, what's under a hashtag or who mentioned who. It's only as good as the last refresh and the depth we walk.
+type PostIndex struct {
+	backend Backend
+	depth   int
+	resolve func(string) (string, error) //turns mentions into keys, usually ResolverChain.Resolve
+
+	lock    sync.RWMutex
+	replies map[string][]PostRef
+	tagged  map[string][]datedPost //newest first
+	//what each account should hear about by lower cased key, newest first.
+	notified map[string][]datedPost
+	//what's been dug out of each post's content. Content never changes so neither does this.
+	parsed map[string]parsedContent
+}
+
+//parsedContent is what the index takes from a post's content instead of what the post says about itself.
+type parsedContent struct {
+	tags     []string
+	mentions []string //as written, resolving can change so it happens every refresh
+}
+
+//datedPost is an entry in one of the newest first lists.
+type datedPost struct {
+	PostRef
+	created time.Time
+	reason  string //for notifications
+}
+
+//why someone is being notified about a post.
+const (
+	MentionNotification = "mention"
+	ReplyNotification   = "reply"
+)
+
+//Notification is a post someone should know about and why.
+type Notification struct {
+	PostRef
+	Reason string
+}
+
+func NewPostIndex(backend Backend, depth int, resolve func(string) (string, error)) *PostIndex {
+	return &PostIndex{
+		backend:  backend,
+		depth:    depth,
+		resolve:  resolve,
+		replies:  map[string][]PostRef{},
+		tagged:   map[string][]datedPost{},
+		notified: map[string][]datedPost{},
+		parsed:   map[string]parsedContent{},
+	}
+}
+
+//Run refreshes the index every interval until the context is cancelled.
+func (idx *PostIndex) Run(ctx context.Context, interval time.Duration) {
+	for {
+		idx.Refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (idx *PostIndex) Refresh(ctx context.Context) {
+	start := time.Now()
+	replies := map[string][]PostRef{}
+	tagged := map[string][]datedPost{}
+	notified := map[string][]datedPost{}
+	parsed := map[string]parsedContent{}
+	users := idx.backend.Users()
+	for _, key := range users {
+		user, err := idx.backend.GetUserById(ctx, key)
+		if err != nil {
+			log.Printf("index couldn't get %s, %s", key, err)
+			continue
+		}
+		for p := range idx.backend.GetPosts(ctx, user, idx.depth) {
+			ref := PostRef{CID: p.CID, Author: key}
+			if p.InReplyTo != nil {
+				replies[p.InReplyTo.CID] = append(replies[p.InReplyTo.CID], ref)
+				notify(notified, p.InReplyTo.Author, datedPost{ref, p.Created, ReplyNotification})
+			}
+			//a repost shows up under the original.
+			if p.RepostOf != nil {
+				continue
+			}
+			content, ok := idx.parse(ctx, p.Post, parsed)
+			if !ok {
+				continue
+			}
+			for _, tag := range content.tags {
+				tagged[tag] = append(tagged[tag], datedPost{ref, p.Created, ""})
+			}
+			for _, mentioned := range idx.mentioned(p.Post, content) {
+				notify(notified, mentioned, datedPost{ref, p.Created, MentionNotification})
+			}
+		}
+	}
+	for _, posts := range tagged {
+		newestFirst(posts)
+	}
+	for _, posts := range notified {
+		newestFirst(posts)
+	}
+
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	idx.replies = replies
+	idx.tagged = tagged
+	idx.notified = notified
+	idx.parsed = parsed
+	log.Printf("indexed %d users and %d tags in %s", len(users), len(tagged), time.Since(start))
+}
+
+func newestFirst(posts []datedPost) {
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].created.Equal(posts[j].created) {
+			return posts[i].created.After(posts[j].created)
+		}
+		return posts[i].CID < posts[j].CID
+	})
+}
+
+//keys get compared case insensitively everywhere else so index them that way. Nobody hears about their own posts
+//and a reply that also mentions you is one notification.
+func notify(notified map[string][]datedPost, key string, p datedPost) {
+	key = strings.ToLower(key)
+	if key == "" || key == strings.ToLower(p.Author) {
+		return
+	}
+	for _, n := range notified[key] {
+		if n.CID == p.CID {
+			return
+		}
+	}
+	notified[key] = append(notified[key], p)
+}
+
+//tags and mentions come from the content even when a post lists its own. Otherwise a post could put itself
+//under any tag or in anyone's notifications without saying anything about them.
+func (idx *PostIndex) parse(ctx context.Context, p Post, found map[string]parsedContent) (parsedContent, bool) {
+	idx.lock.RLock()
+	parsed, cached := idx.parsed[p.Content]
+	idx.lock.RUnlock()
+	if !cached {
+		content, err := CatString(ctx, idx.backend, p.Content)
+		if err != nil {
+			//try again next refresh.
+			log.Printf("index couldn't read %s, %s", p.Content, err)
+			return parsed, false
+		}
+		parsed = parsedContent{tags: ExtractTags(content), mentions: ExtractMentions(content)}
+	}
+	found[p.Content] = parsed
+	return parsed, true
+}
+
+//mentioned is who the post both says it mentions and really does. Mentions were resolved when it was
+//posted so a name that resolves somewhere else now doesn't drag in whoever has it.
+func (idx *PostIndex) mentioned(p Post, content parsedContent) []string {
+	if len(p.Mentions) == 0 || len(content.mentions) == 0 {
+		return nil
+	}
+	keys, err := ResolveMentions(content.mentions, idx.resolve)
+	if err != nil {
+		log.Printf("index couldn't resolve mentions in %s, %s", p.Content, err)
+		return nil
+	}
+	mentioned := []string{}
+	for _, key := range keys {
+		if containsFold(p.Mentions, key) {
+			mentioned = append(mentioned, key)
+		}
+	}
+	return mentioned
+}
+
+//Tagged returns a page of the posts under tag, newest first, and how many there are altogether.
+func (idx *PostIndex) Tagged(tag string, offset, limit int) ([]PostRef, int) {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	posts := idx.tagged[NormalizeTag(tag)]
+	page := []PostRef{}
+	for i := offset; i >= 0 && i < len(posts) && len(page) < limit; i++ {
+		page = append(page, posts[i].PostRef)
+	}
+	return page, len(posts)
+}
+
+//Notifications returns a page of what key should know about, newest first, and how many there are altogether.
+func (idx *PostIndex) Notifications(key string, offset, limit int) ([]Notification, int) {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	posts := idx.notified[strings.ToLower(key)]
+	page := []Notification{}
+	for i := offset; i >= 0 && i < len(posts) && len(page) < limit; i++ {
+		page = append(page, Notification{posts[i].PostRef, posts[i].reason})
+	}
+	return page, len(posts)
+}
+
+//Replies returns the direct replies we know about to cid.
+func (idx *PostIndex) Replies(cid string) []PostRef {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	return append([]PostRef{}, idx.replies[cid]...)
+}
@@ -0,0 +1,111 @@
+package zebu
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIndexReplies(t *testing.T) {
+	m := newMemBackend()
+	alice := User{PublicName: "0xA11CE", DisplayName: "alice.northbriton.net"}
+	bob := User{PublicName: "0xB0B"}
+
+	root := m.post(t, &alice, Post{Content: "hello"})
+	m.post(t, &alice, Post{Content: "unrelated"})
+	reply := m.post(t, &bob, Post{Content: "hi", InReplyTo: &PostRef{CID: root, Author: alice.PublicName}})
+
+	idx := NewPostIndex(m, 10, NewResolverChain(KeyResolver{}).Resolve)
+	idx.Refresh(context.Background())
+
+	replies := idx.Replies(root)
+	if len(replies) != 1 {
+		t.Fatalf("expected 1 reply got %v", replies)
+	}
+	if replies[0].CID != reply || replies[0].Author != bob.PublicName {
+		t.Fatalf("wrong reply %v", replies[0])
+	}
+	if len(idx.Replies(reply)) != 0 {
+		t.Fatalf("reply shouldn't have replies")
+	}
+}
+
+func TestIndexTags(t *testing.T) {
+	m := newMemBackend()
+	ctx := context.Background()
+	alice := User{PublicName: "0xA11CE"}
+	bob := User{PublicName: "0xB0B"}
+
+	//older clients didn't set Tags so the index has to read the content.
+	legacy, _ := m.Add(ctx, strings.NewReader("old school #Zebu post"))
+	oldest := m.post(t, &alice, Post{Content: legacy, Created: time.Now().Add(-time.Hour)})
+	content, _ := m.Add(ctx, strings.NewReader("#zebu #stripes"))
+	newest := m.post(t, &bob, Post{Content: content, Tags: []string{"zebu", "stripes"}})
+	m.post(t, &alice, Post{Content: content, RepostOf: &PostRef{CID: newest, Author: bob.PublicName}})
+	//Tags that aren't in the content don't count.
+	plain, _ := m.Add(ctx, strings.NewReader("nothing to see here"))
+	m.post(t, &bob, Post{Content: plain, Tags: []string{"zebu", "spam"}, Created: time.Now().Add(-2 * time.Hour)})
+
+	idx := NewPostIndex(m, 10, NewResolverChain(KeyResolver{}).Resolve)
+	idx.Refresh(ctx)
+
+	page, total := idx.Tagged("#ZEBU", 0, 1)
+	if total != 2 || len(page) != 1 || page[0].CID != newest || page[0].Author != bob.PublicName {
+		t.Fatalf("expected newest first got %v of %d", page, total)
+	}
+	page, _ = idx.Tagged("zebu", 1, 1)
+	if len(page) != 1 || page[0].CID != oldest {
+		t.Fatalf("expected oldest on the second page got %v", page)
+	}
+	if page, _ = idx.Tagged("zebu", 2, 1); len(page) != 0 {
+		t.Fatalf("ran off the end %v", page)
+	}
+	if _, total = idx.Tagged("stripes", 0, 10); total != 1 {
+		t.Fatalf("repost shouldn't count twice, got %d", total)
+	}
+	if _, total = idx.Tagged("spam", 0, 10); total != 0 {
+		t.Fatalf("declared a tag that isn't in the content, got %d", total)
+	}
+}
+
+func TestIndexNotifications(t *testing.T) {
+	m := newMemBackend()
+	ctx := context.Background()
+	alice := User{PublicName: "0xA11CE"}
+	bob := User{PublicName: "0xB0B"}
+	carol := User{PublicName: "0xCA201"}
+	text := func(s string) string {
+		cid, _ := m.Add(ctx, strings.NewReader(s))
+		return cid
+	}
+
+	root := m.post(t, &alice, Post{Content: text("hello"), Created: time.Now().Add(-time.Hour)})
+	reply := m.post(t, &bob, Post{Content: text("hi @alice.eth"), InReplyTo: &PostRef{CID: root, Author: "0xa11ce"}, Mentions: []string{"0xa11ce"}, Created: time.Now().Add(-time.Minute)})
+	mention := m.post(t, &bob, Post{Content: text("cc @alice.eth"), Mentions: []string{alice.PublicName}})
+	m.post(t, &alice, Post{Content: text("talking to myself @alice.eth"), InReplyTo: &PostRef{CID: root, Author: alice.PublicName}, Mentions: []string{alice.PublicName}})
+	//declaring a mention that isn't in the content or mentioning without declaring it doesn't notify anyone.
+	m.post(t, &bob, Post{Content: text("nothing to see here"), Mentions: []string{carol.PublicName}})
+	m.post(t, &bob, Post{Content: text("psst @carol.eth")})
+
+	resolvers := NewResolverChain(KeyResolver{}, NewAliasResolver(map[string]string{"alice.eth": alice.PublicName, "carol.eth": carol.PublicName}))
+	idx := NewPostIndex(m, 10, resolvers.Resolve)
+	idx.Refresh(ctx)
+
+	notes, total := idx.Notifications("0xa11ce", 0, 10)
+	if total != 2 || len(notes) != 2 {
+		t.Fatalf("expected a reply and a mention got %v", notes)
+	}
+	if notes[0].CID != mention || notes[0].Reason != MentionNotification || notes[0].Author != bob.PublicName {
+		t.Fatalf("expected newest mention first got %v", notes[0])
+	}
+	if notes[1].CID != reply || notes[1].Reason != ReplyNotification {
+		t.Fatalf("reply that mentions should be one reply got %v", notes[1])
+	}
+	if _, total := idx.Notifications(bob.PublicName, 0, 10); total != 0 {
+		t.Fatalf("bob shouldn't have notifications, got %d", total)
+	}
+	if _, total := idx.Notifications(carol.PublicName, 0, 10); total != 0 {
+		t.Fatalf("carol was never really mentioned, got %d", total)
+	}
+}
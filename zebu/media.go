@@ -0,0 +1,76 @@
+package zebu
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	cidlib "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+//Open is Cat for things served in ranges like video. Nothing is read until you Read.
+func (b *IpfsBackend) Open(ctx context.Context, cidstr string) (io.ReadSeekCloser, error) {
+	cid, err := cidlib.Parse(cidstr)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := b.api.Unixfs().Get(ctx, path.IpfsPath(cid))
+	if err != nil {
+		return nil, fmt.Errorf("faild to get object %s, %w", path.IpfsPath(cid), err)
+	}
+	f := files.ToFile(entry)
+	if f == nil {
+		return nil, fmt.Errorf("%s not a file", cidstr)
+	}
+	size, err := f.Size()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &lazySeeker{f: f, size: size}, nil
+}
+
+//lazySeeker only seeks the underlying file when it has to read.
+//http api files read and throw away everything up to a forward seek so asking for the size would read the whole thing.
+type lazySeeker struct {
+	f    files.File
+	size int64
+	pos  int64 //where we've been asked to be
+	at   int64 //where f actually is
+}
+
+func (s *lazySeeker) Read(p []byte) (int, error) {
+	if s.pos != s.at {
+		if _, err := s.f.Seek(s.pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+		s.at = s.pos
+	}
+	n, err := s.f.Read(p)
+	s.pos += int64(n)
+	s.at = s.pos
+	return n, err
+}
+
+func (s *lazySeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, fmt.Errorf("bad whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("can't seek to %d", offset)
+	}
+	s.pos = offset
+	return offset, nil
+}
+
+func (s *lazySeeker) Close() error {
+	return s.f.Close()
+}
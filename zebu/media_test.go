@@ -0,0 +1,42 @@
+package zebu
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+func TestLazySeeker(t *testing.T) {
+	f, err := files.NewReaderPathFile("digits", nopSeekCloser{bytes.NewReader([]byte("0123456789"))}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &lazySeeker{f: f, size: 10}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil || end != 10 {
+		t.Fatalf("end was %d %v", end, err)
+	}
+	if s.at != 0 {
+		t.Fatalf("finding the size shouldn't move the file")
+	}
+	if _, err := s.Seek(-4, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(s, buf); err != nil || string(buf) != "67" {
+		t.Fatalf("read %q %v", buf, err)
+	}
+	if pos, _ := s.Seek(1, io.SeekCurrent); pos != 9 {
+		t.Fatalf("current was %d", pos)
+	}
+	rest, err := ioutil.ReadAll(s)
+	if err != nil || string(rest) != "9" {
+		t.Fatalf("rest %q %v", rest, err)
+	}
+	if _, err := s.Seek(-1, io.SeekStart); err == nil {
+		t.Fatalf("seeked before start")
+	}
+}
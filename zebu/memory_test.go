@@ -0,0 +1,171 @@
+package zebu
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+//memBackend is just enough of a Backend to test things that walk chains without ipfs.
+type memBackend struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+	users   map[string]User
+	deleted []string //posts GetPosts hid because they were deleted
+}
+
+var _ Backend = &memBackend{}
+
+func newMemBackend() *memBackend {
+	return &memBackend{objects: map[string][]byte{}, users: map[string]User{}}
+}
+
+func (m *memBackend) put(data []byte) string {
+	sum := sha256.Sum256(data)
+	cid := "mem" + hex.EncodeToString(sum[:8])
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.objects[cid] = data
+	return cid
+}
+
+func (m *memBackend) get(cid string) ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	data, found := m.objects[cid]
+	if !found {
+		return nil, fmt.Errorf("%s not found", cid)
+	}
+	return data, nil
+}
+
+func (m *memBackend) GetPosts(ctx context.Context, user User, count int) <-chan FetchedPost {
+	return walkPosts(user, count, func(cid string) (Post, error) {
+		return m.GetPost(ctx, cid)
+	}, func(p FetchedPost) {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		m.deleted = append(m.deleted, p.CID)
+	})
+}
+
+func (m *memBackend) GetPost(ctx context.Context, cid string) (Post, error) {
+	var post Post
+	data, err := m.get(cid)
+	if err != nil {
+		return post, err
+	}
+	err = json.Unmarshal(data, &post)
+	return post, err
+}
+
+func (m *memBackend) SavePost(ctx context.Context, post Post) (string, error) {
+	data, err := json.Marshal(post)
+	if err != nil {
+		return "", err
+	}
+	return m.put(data), nil
+}
+
+func (m *memBackend) Cat(ctx context.Context, cid string) (io.ReadCloser, error) {
+	data, err := m.get(cid)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+type nopSeekCloser struct{ *bytes.Reader }
+
+func (nopSeekCloser) Close() error { return nil }
+
+func (m *memBackend) Open(ctx context.Context, cid string) (io.ReadSeekCloser, error) {
+	data, err := m.get(cid)
+	if err != nil {
+		return nil, err
+	}
+	return nopSeekCloser{bytes.NewReader(data)}, nil
+}
+
+func (m *memBackend) Add(ctx context.Context, r io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return m.put(data), nil
+}
+
+func (m *memBackend) Remove(ctx context.Context, cid string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.objects, cid)
+	return nil
+}
+
+func (m *memBackend) GetUserById(ctx context.Context, id string) (User, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	user, found := m.users[id]
+	if !found {
+		return User{PublicName: id}, nil
+	}
+	return user, nil
+}
+
+func (m *memBackend) PublishUser(ctx context.Context, unr UserNameRecord) error {
+	return fmt.Errorf("memBackend doesn't publish")
+}
+
+func (m *memBackend) SaveUserCid(ctx context.Context, user User) (UserNameRecord, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.users[user.PublicName] = user
+	return UserNameRecord{PubKey: user.PublicName}, nil
+}
+
+func (m *memBackend) Forks(pubkey string) []Fork { return nil }
+
+func (m *memBackend) History(ctx context.Context, pubkey string) ([]UserNameRecord, error) {
+	return nil, fmt.Errorf("memBackend doesn't keep history")
+}
+
+func (m *memBackend) Healthz(ctx context.Context) bool { return true }
+
+func (m *memBackend) RandomUsers(n int) []string { return m.Users() }
+
+func (m *memBackend) Users() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	users := []string{}
+	for k := range m.users {
+		users = append(users, k)
+	}
+	return users
+}
+
+//post appends a post to users chain the way the routes do and returns its cid.
+func (m *memBackend) post(t *testing.T, user *User, post Post) string {
+	t.Helper()
+	post.Previous = user.LastPost
+	post.Author = user.Name()
+	if post.Created.IsZero() {
+		post.Created = time.Now().UTC()
+	}
+	cid, err := m.SavePost(context.Background(), post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.LastPost = cid
+	if _, err := m.SaveUserCid(context.Background(), *user); err != nil {
+		t.Fatal(err)
+	}
+	return cid
+}
@@ -0,0 +1,78 @@
+package zebu
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//mentions are @name.northbriton.net, @name.eth or @0x… and the same trick as hashtags keeps emails and urls out.
+var mention = regexp.MustCompile(`(^|[^\p{L}\p{N}_@/.])@([\p{L}\p{N}_-]+(?:\.[\p{L}\p{N}_-]+)*)`)
+
+//every mention is a lookup when posting so don't let one post do hundreds.
+const maxMentions = 20
+
+//ErrAmbiguousMention is a bare @name. It could be dns or ens so we make people say which.
+var ErrAmbiguousMention = errors.New("ambiguous mention")
+
+//mentionable is whether name says what it is. Anything else is a bare name.
+func mentionable(name string) bool {
+	if strings.HasPrefix(name, EthereumPrefix) {
+		return common.IsHexAddress(name)
+	}
+	return strings.Contains(name, ".")
+}
+
+//ExtractMentions finds who content mentions as written, without the @ and without duplicates.
+//Code and urls don't count. Names are lower cased, addresses are left alone.
+func ExtractMentions(content string) []string {
+	content = markdownCode.ReplaceAllString(content, " ")
+	content = bareURL.ReplaceAllString(content, " ")
+	names := []string{}
+	for _, m := range mention.FindAllStringSubmatch(content, -1) {
+		name := m[2]
+		if !strings.HasPrefix(name, EthereumPrefix) {
+			name = strings.ToLower(name)
+		}
+		if contains(names, name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+//ResolveMentions turns names from ExtractMentions into keys with resolve (usually Resolve).
+//A bare name or one that doesn't resolve is almost certainly a mistake so the whole thing fails and the post should be rejected.
+func ResolveMentions(names []string, resolve func(string) (string, error)) ([]string, error) {
+	if len(names) > maxMentions {
+		return nil, fmt.Errorf("can't mention more than %d accounts in a post", maxMentions)
+	}
+	keys := []string{}
+	for _, name := range names {
+		if !mentionable(name) {
+			return nil, fmt.Errorf("%w, did you mean @%s.northbriton.net or @%s.eth?", ErrAmbiguousMention, name, name)
+		}
+		key, err := resolve(name)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't find @%s, %w", name, err)
+		}
+		//two names for the same account is still one mention.
+		if !containsFold(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return true
+		}
+	}
+	return false
+}
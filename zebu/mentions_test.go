@@ -0,0 +1,55 @@
+package zebu
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	addr := "0x5AEDA56215b167893e80B4fE645BA6d5Bab767DE"
+	cases := map[string][]string{
+		"hi @Alice.northbriton.net and @bob.eth.":            {"alice.northbriton.net", "bob.eth"},
+		"(@" + addr + ") @bob.eth again @BOB.eth":            {addr, "bob.eth"},
+		"email me@x.com or see https://x/@someone":           {},
+		"`@code.eth` and ```\n@block.eth\n```  @real.eth":    {"real.eth"},
+		"@bare names are found so they can be complained at": {"bare"},
+	}
+	for content, want := range cases {
+		if got := ExtractMentions(content); !reflect.DeepEqual(got, want) {
+			t.Errorf("ExtractMentions(%q) = %v want %v", content, got, want)
+		}
+	}
+}
+
+func TestResolveMentions(t *testing.T) {
+	addr := "0x5AEDA56215b167893e80B4fE645BA6d5Bab767DE"
+	names := map[string]string{"alice.northbriton.net": addr, "alice.eth": addr, "bob.eth": "0xB0B"}
+	resolve := func(name string) (string, error) {
+		if IsPublicKey(name) {
+			return name, nil
+		}
+		if key, found := names[name]; found {
+			return key, nil
+		}
+		return "", fmt.Errorf("no %s", name)
+	}
+
+	keys, err := ResolveMentions([]string{"alice.northbriton.net", "bob.eth", "alice.eth", addr}, resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{addr, "0xB0B"}) {
+		t.Fatalf("expected each account once got %v", keys)
+	}
+	if _, err := ResolveMentions([]string{"alice"}, resolve); !errors.Is(err, ErrAmbiguousMention) {
+		t.Fatalf("bare name should be ambiguous got %v", err)
+	}
+	if _, err := ResolveMentions([]string{"0x1234"}, resolve); !errors.Is(err, ErrAmbiguousMention) {
+		t.Fatalf("short address should be rejected got %v", err)
+	}
+	if _, err := ResolveMentions([]string{"nobody.eth"}, resolve); err == nil {
+		t.Fatalf("unresolvable mention should fail")
+	}
+}
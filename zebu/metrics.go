@@ -0,0 +1,28 @@
+package zebu
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//cmd serves everything in the default registry on /metrics.
+var (
+	catHist = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name: "zebu_cat_seconds",
+		Help: "How long reading content out of ipfs takes.",
+	})
+	//only lookups that missed the cache, the rest are free.
+	resolveHist = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "zebu_resolve_seconds",
+		Help: "How long looking up a name with dns or ens takes.",
+	}, []string{"result"})
+	//hit rate is hit over the total.
+	resolveCacheCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "zebu_resolve_cache_total",
+		Help: "Name resolutions by whether the cache answered. hit, negative (a cached not found), coalesced (waited on someone else's lookup) or miss.",
+	}, []string{"result"})
+	resolverCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "zebu_resolver_total",
+		Help: "Name resolutions by which resolver in the chain answered and whether it found anything.",
+	}, []string{"resolver", "result"})
+)
@@ -0,0 +1,121 @@
+package zebu
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	//how long we remember a live post using a file or a deleted post we've let go of.
+	pinMemory = 24 * time.Hour
+	//past this many entries we sweep out what's older than pinMemory when adding.
+	pinRefsSweep = 100000
+)
+
+//pinRefs works out what to stop hosting when posts are deleted. Content, images, attachments and previews are
+//content addressed so an edit, a repost or someone else saying the same thing can share them. We count the live
+//posts we've walked that use each file and only let go of files nothing live uses. A live post we hadn't walked
+//yet when the delete came along gets its files back the next time it is walked.
+type pinRefs struct {
+	now func() time.Time
+
+	lock     sync.Mutex
+	live     map[string]map[string]time.Time //file to the live posts using it and when we saw them
+	deleted  map[string]time.Time            //deleted posts we've already let go of
+	unpinned map[string]time.Time            //files we let go of
+}
+
+func newPinRefs() *pinRefs {
+	return &pinRefs{
+		now:      time.Now,
+		live:     map[string]map[string]time.Time{},
+		deleted:  map[string]time.Time{},
+		unpinned: map[string]time.Time{},
+	}
+}
+
+//the files a post shows.
+func postFiles(p Post) []string {
+	files := []string{p.Content, p.Preview}
+	files = append(files, p.Images...)
+	for _, a := range p.Attachments {
+		files = append(files, a.CID, a.Medium, a.Thumbnail)
+	}
+	return files
+}
+
+//seen counts a live post against its files. Anything we'd let go of comes back to be pinned again.
+func (r *pinRefs) seen(p FetchedPost) []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := r.now()
+	r.maybeSweep(now)
+	repin := []string{}
+	for _, file := range postFiles(p.Post) {
+		if file == "" {
+			continue
+		}
+		if r.live[file] == nil {
+			r.live[file] = map[string]time.Time{}
+		}
+		r.live[file][p.CID] = now
+		if _, found := r.unpinned[file]; found {
+			delete(r.unpinned, file)
+			repin = append(repin, file)
+		}
+	}
+	return repin
+}
+
+//gone is what to unpin for a deleted post, the post itself and whichever of its files no live post uses.
+//Reposts only give up themselves, their files are the original author's. Nothing if we've done it already.
+func (r *pinRefs) gone(p FetchedPost) []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, found := r.deleted[p.CID]; found {
+		return nil
+	}
+	now := r.now()
+	r.maybeSweep(now)
+	r.deleted[p.CID] = now
+	unpin := []string{p.CID}
+	for _, file := range postFiles(p.Post) {
+		if file == "" {
+			continue
+		}
+		//it was live until now.
+		delete(r.live[file], p.CID)
+		if len(r.live[file]) > 0 {
+			continue
+		}
+		delete(r.live, file)
+		if _, found := r.unpinned[file]; !found && p.RepostOf == nil {
+			r.unpinned[file] = now
+			unpin = append(unpin, file)
+		}
+	}
+	return unpin
+}
+
+func (r *pinRefs) maybeSweep(now time.Time) {
+	if len(r.live)+len(r.deleted)+len(r.unpinned) <= pinRefsSweep {
+		return
+	}
+	for file, users := range r.live {
+		for post, seen := range users {
+			if now.Sub(seen) > pinMemory {
+				delete(users, post)
+			}
+		}
+		if len(users) == 0 {
+			delete(r.live, file)
+		}
+	}
+	for _, set := range []map[string]time.Time{r.deleted, r.unpinned} {
+		for cid, at := range set {
+			if now.Sub(at) > pinMemory {
+				delete(set, cid)
+			}
+		}
+	}
+}
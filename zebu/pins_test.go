@@ -0,0 +1,61 @@
+package zebu
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPinRefs(t *testing.T) {
+	refs := newPinRefs()
+	now := time.Now()
+	refs.now = func() time.Time { return now }
+	sorted := func(cids []string) []string {
+		sort.Strings(cids)
+		return cids
+	}
+
+	shared := FetchedPost{CID: "QmShared", Post: Post{Content: "QmGm", Images: []string{"QmCat"}}}
+	same := FetchedPost{CID: "QmSame", Post: Post{Content: "QmGm", Preview: "QmPreview"}}
+	repost := FetchedPost{CID: "QmRepost", Post: Post{Content: "QmGm", Images: []string{"QmCat"}, RepostOf: &PostRef{CID: "QmShared"}}}
+	for _, p := range []FetchedPost{shared, same, repost} {
+		if repin := refs.seen(p); len(repin) != 0 {
+			t.Fatalf("nothing was unpinned to pin again got %v", repin)
+		}
+	}
+
+	if unpin := refs.gone(repost); !reflect.DeepEqual(unpin, []string{"QmRepost"}) {
+		t.Fatalf("a deleted repost should only give up itself got %v", unpin)
+	}
+	if unpin := sorted(refs.gone(shared)); !reflect.DeepEqual(unpin, []string{"QmCat", "QmShared"}) {
+		t.Fatalf("content someone else says too should stay got %v", unpin)
+	}
+	if unpin := refs.gone(shared); unpin != nil {
+		t.Fatalf("deletes we've done shouldn't be done again got %v", unpin)
+	}
+
+	//an older post using the cat that we hadn't walked yet.
+	later := FetchedPost{CID: "QmLater", Post: Post{Content: "QmMeow", Attachments: []Attachment{{CID: "QmCat"}}}}
+	if repin := refs.seen(later); !reflect.DeepEqual(repin, []string{"QmCat"}) {
+		t.Fatalf("expected the cat back got %v", repin)
+	}
+	if unpin := sorted(refs.gone(same)); !reflect.DeepEqual(unpin, []string{"QmGm", "QmPreview", "QmSame"}) {
+		t.Fatalf("nothing live says gm anymore got %v", unpin)
+	}
+
+	//forgotten after a while so the maps don't grow forever.
+	now = now.Add(pinMemory + time.Minute)
+	refs.maybeSweep(now)
+	if len(refs.live) == 0 || len(refs.deleted) == 0 {
+		t.Fatalf("shouldn't sweep until there's lots to sweep")
+	}
+	for i := 0; i < pinRefsSweep; i++ {
+		refs.deleted[fmt.Sprint(i)] = now
+	}
+	refs.maybeSweep(now)
+	if len(refs.live) != 0 || len(refs.unpinned) != 0 || len(refs.deleted) != pinRefsSweep {
+		t.Fatalf("expected only what's old to be swept got %d live %d unpinned %d deleted", len(refs.live), len(refs.unpinned), len(refs.deleted))
+	}
+}
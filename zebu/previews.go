@@ -0,0 +1,294 @@
+package zebu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+//LinkPreview is what a link in a post looked like when it was posted. It's saved to ipfs with the post
+//so readers never go to the site themselves. Image is a thumbnail we saved, never the site's url.
+type LinkPreview struct {
+	URL         string
+	Title       string
+	Description string `json:"Description,omitempty"`
+	SiteName    string `json:"SiteName,omitempty"`
+	Image       string `json:"Image,omitempty"`
+}
+
+const (
+	previewTimeout     = 10 * time.Second
+	maxPreviewPage     = 1 << 20 //og tags are in the head, nobody needs the whole page.
+	maxPreviewImage    = 10 << 20
+	maxPreviewRedirect = 5
+	maxPreviewTitle    = 300 //characters
+	maxPreviewText     = 1000
+)
+
+var ErrPrivateAddress = errors.New("won't fetch from a private address")
+
+//PreviewFetcher gets link previews for posts without letting people point the server at things only it can see.
+//Every connection is checked after dns so redirects and rebinding don't get around it.
+type PreviewFetcher struct {
+	client  *http.Client
+	allowed []netip.Prefix
+}
+
+//NewPreviewFetcher refuses loopback, private, link local and the like unless they're in allowed.
+func NewPreviewFetcher(allowed ...netip.Prefix) *PreviewFetcher {
+	f := &PreviewFetcher{allowed: allowed}
+	dialer := &net.Dialer{Timeout: previewTimeout, Control: f.checkDial}
+	f.client = &http.Client{
+		Timeout: previewTimeout,
+		Transport: &http.Transport{
+			//a proxy would be the address we check so go direct.
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   previewTimeout,
+			ResponseHeaderTimeout: previewTimeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       time.Minute,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxPreviewRedirect {
+				return fmt.Errorf("more than %d redirects", maxPreviewRedirect)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("won't follow a redirect to %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+	return f
+}
+
+func (f *PreviewFetcher) checkDial(network, address string, _ syscall.RawConn) error {
+	addrport, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	addr := addrport.Addr().Unmap()
+	for _, p := range f.allowed {
+		if p.Contains(addr) {
+			return nil
+		}
+	}
+	if !publicAddress(addr) {
+		return fmt.Errorf("%w %s", ErrPrivateAddress, addr)
+	}
+	return nil
+}
+
+//carrier grade nat isn't private to IsPrivate but it isn't the internet either.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func publicAddress(addr netip.Addr) bool {
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+//get fetches rawurl if it's the content type we want and gives back at most limit bytes of it.
+func (f *PreviewFetcher) get(ctx context.Context, rawurl string, limit int64, accept func(mediatype string) bool) ([]byte, string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, "", fmt.Errorf("won't fetch %s urls", u.Scheme)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", "zebu link preview")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%s gave %d", rawurl, resp.StatusCode)
+	}
+	mediatype, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !accept(mediatype) {
+		return nil, "", fmt.Errorf("%s is %s", rawurl, mediatype)
+	}
+	if resp.ContentLength > limit {
+		return nil, "", fmt.Errorf("%s is %d bytes", rawurl, resp.ContentLength)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit))
+	//where we ended up is what relative urls are relative to.
+	return body, resp.Request.URL.String(), err
+}
+
+//Preview fetches rawurl's opengraph or twitter card, saves its image and the preview to backend and returns the preview's CID.
+func (f *PreviewFetcher) Preview(ctx context.Context, backend ContentBackend, rawurl string) (string, error) {
+	page, final, err := f.get(ctx, rawurl, maxPreviewPage, func(mediatype string) bool {
+		return mediatype == "text/html" || mediatype == "application/xhtml+xml"
+	})
+	if err != nil {
+		return "", err
+	}
+	preview, image := parsePreview(page, final)
+	if preview.Title == "" {
+		return "", fmt.Errorf("nothing to preview at %s", rawurl)
+	}
+	preview.URL = rawurl
+	if image != "" {
+		//a preview without a picture is still a preview.
+		preview.Image, err = f.saveImage(ctx, backend, image)
+		if err != nil {
+			preview.Image = ""
+		}
+	}
+	data, err := json.Marshal(preview)
+	if err != nil {
+		return "", err
+	}
+	return backend.Add(ctx, strings.NewReader(string(data)))
+}
+
+//only the thumbnail is saved. It's all the card shows.
+func (f *PreviewFetcher) saveImage(ctx context.Context, backend ContentBackend, rawurl string) (string, error) {
+	data, _, err := f.get(ctx, rawurl, maxPreviewImage, func(mediatype string) bool {
+		return strings.HasPrefix(mediatype, "image/")
+	})
+	if err != nil {
+		return "", err
+	}
+	processed, err := ProcessImage(data)
+	if err != nil {
+		return "", err
+	}
+	thumbnail := processed.Thumbnail
+	if thumbnail == nil {
+		thumbnail = processed.Original
+	}
+	return backend.Add(ctx, strings.NewReader(string(thumbnail)))
+}
+
+//GetPreview reads a preview saved by Preview.
+func GetPreview(ctx context.Context, backend ContentBackend, cid string) (LinkPreview, error) {
+	r, err := backend.Cat(ctx, cid)
+	if err != nil {
+		return LinkPreview{}, err
+	}
+	var preview LinkPreview
+	err = json.NewDecoder(io.LimitReader(r, maxPreviewPage)).Decode(&preview)
+	return preview, err
+}
+
+//parsePreview pulls the card out of the head of page. Opengraph wins over twitter which wins over plain html.
+//The image url comes back separately resolved against base.
+func parsePreview(page []byte, base string) (LinkPreview, string) {
+	found := map[string]string{}
+	set := func(key, value string) {
+		value = strings.Join(strings.Fields(value), " ")
+		if _, already := found[key]; !already && value != "" {
+			found[key] = value
+		}
+	}
+	z := nethtml.NewTokenizer(strings.NewReader(string(page)))
+	inTitle := false
+loop:
+	for {
+		tt := z.Next()
+		switch tt {
+		case nethtml.ErrorToken:
+			break loop
+		case nethtml.TextToken:
+			if inTitle {
+				set("title", string(z.Text()))
+			}
+		case nethtml.EndTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Head:
+				break loop
+			case atom.Title:
+				inTitle = false
+			}
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Body:
+				break loop
+			case atom.Title:
+				inTitle = tt == nethtml.StartTagToken
+			case atom.Meta:
+				attrs := map[string]string{}
+				for hasAttr {
+					var k, v []byte
+					k, v, hasAttr = z.TagAttr()
+					attrs[string(k)] = string(v)
+				}
+				//og uses property and twitter uses name but plenty of sites mix them up.
+				key := attrs["property"]
+				if key == "" {
+					key = attrs["name"]
+				}
+				set(strings.ToLower(key), attrs["content"])
+			}
+		}
+	}
+
+	first := func(keys ...string) string {
+		for _, k := range keys {
+			if v := found[k]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	preview := LinkPreview{
+		Title:       truncate(first("og:title", "twitter:title", "title"), maxPreviewTitle),
+		Description: truncate(first("og:description", "twitter:description", "description"), maxPreviewText),
+		SiteName:    truncate(first("og:site_name"), maxPreviewTitle),
+	}
+	image := first("og:image", "og:image:url", "og:image:secure_url", "twitter:image", "twitter:image:src")
+	if image != "" {
+		b, err := url.Parse(base)
+		i, ierr := url.Parse(image)
+		if err != nil || ierr != nil {
+			return preview, ""
+		}
+		image = b.ResolveReference(i).String()
+	}
+	return preview, image
+}
+
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max-1]) + "…"
+}
+
+//FirstLink is the url a post is about, the first http link that isn't in code.
+func FirstLink(content string) string {
+	content = markdownCode.ReplaceAllString(content, " ")
+	for _, m := range inlineSpan.FindAllStringSubmatch(content, -1) {
+		link := m[3]
+		if link == "" {
+			link = strings.TrimRight(m[4], ".,;:!?)")
+		}
+		if strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://") {
+			return link
+		}
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package zebu
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestParsePreview(t *testing.T) {
+	page := `<html><head>
+		<title>  Plain   title </title>
+		<meta name="twitter:title" content="Twitter title">
+		<meta property="og:title" content="OG &amp; title">
+		<meta name="description" content="plain description">
+		<meta name="twitter:image" content="../img/card.png">
+		</head><body><meta property="og:description" content="not in the head"></body></html>`
+	preview, image := parsePreview([]byte(page), "https://example.com/posts/1")
+	if preview.Title != "OG & title" {
+		t.Errorf("og title should win got %q", preview.Title)
+	}
+	if preview.Description != "plain description" {
+		t.Errorf("expected plain description got %q", preview.Description)
+	}
+	if image != "https://example.com/img/card.png" {
+		t.Errorf("relative image should be resolved got %q", image)
+	}
+
+	preview, image = parsePreview([]byte("<title>"+strings.Repeat("x", 500)+"</title>"), "https://example.com/")
+	if len([]rune(preview.Title)) != maxPreviewTitle || image != "" {
+		t.Errorf("expected a truncated title and no image got %d runes and %q", len([]rune(preview.Title)), image)
+	}
+}
+
+func TestFirstLink(t *testing.T) {
+	cases := map[string]string{
+		"see https://example.com/a).":                        "https://example.com/a",
+		"`https://in.code` then [this](https://example.com)": "https://example.com",
+		"[local](/post/abc) and nothing else":                "",
+		"no links":                                           "",
+	}
+	for content, want := range cases {
+		if got := FirstLink(content); got != want {
+			t.Errorf("FirstLink(%q) = %q want %q", content, got, want)
+		}
+	}
+}
+
+func previewServer(t *testing.T) *httptest.Server {
+	var card bytes.Buffer
+	if err := png.Encode(&card, halves(640, 480)); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<head><meta property="og:title" content="A page"><meta property="og:image" content="/card.png"></head>`)
+	})
+	mux.HandleFunc("/card.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(card.Bytes())
+	})
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", fmt.Sprint(maxPreviewPage+1))
+		w.Write(make([]byte, maxPreviewPage+1))
+	})
+	mux.HandleFunc("/binary", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		fmt.Fprint(w, "<title>not html</title>")
+	})
+	mux.HandleFunc("/sneaky", func(w http.ResponseWriter, r *http.Request) {
+		//somewhere else on the box, the allowlist is only for the server itself.
+		http.Redirect(w, r, "http://127.0.0.2:1/", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPreview(t *testing.T) {
+	server := previewServer(t)
+	ctx := context.Background()
+	m := newMemBackend()
+	fetcher := NewPreviewFetcher(netip.MustParsePrefix("127.0.0.1/32"))
+
+	cid, err := fetcher.Preview(ctx, m, server.URL+"/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	preview, err := GetPreview(ctx, m, cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Title != "A page" || preview.URL != server.URL+"/page" || preview.Image == "" {
+		t.Fatalf("bad preview %+v", preview)
+	}
+	data, err := m.get(preview.Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbnail, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || thumbnail.Width != ThumbnailSize {
+		t.Fatalf("expected a %d wide thumbnail got %+v, %v", ThumbnailSize, thumbnail, err)
+	}
+
+	for _, path := range []string{"/big", "/binary", "/missing"} {
+		if _, err := fetcher.Preview(ctx, m, server.URL+path); err == nil {
+			t.Errorf("expected %s to fail", path)
+		}
+	}
+	if _, err := fetcher.Preview(ctx, m, server.URL+"/sneaky"); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("redirect to a private address should be refused got %v", err)
+	}
+	if _, err := fetcher.Preview(ctx, m, "file:///etc/passwd"); err == nil {
+		t.Errorf("only http should be fetched")
+	}
+}
+
+func TestPreviewRefusesPrivate(t *testing.T) {
+	server := previewServer(t)
+	_, err := NewPreviewFetcher().Preview(context.Background(), newMemBackend(), server.URL+"/page")
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("loopback should be refused without an allowlist got %v", err)
+	}
+	for addr, public := range map[string]bool{
+		"8.8.8.8": true, "2606:4700::1111": true,
+		"10.1.2.3": false, "192.168.0.1": false, "169.254.169.254": false, "100.64.0.1": false,
+		"::1": false, "fd00::1": false, "0.0.0.0": false,
+	} {
+		if got := publicAddress(netip.MustParseAddr(addr)); got != public {
+			t.Errorf("publicAddress(%s) = %v", addr, got)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package zebu
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+//Render turns post content into html that's safe to drop into a page.
+//Content that looks like html (the importer copies rss descriptions) is sanitized, anything else is treated as markdown.
+//Either way it ends up going through the same allowlist.
+func Render(content string) template.HTML {
+	if !looksLikeHTML.MatchString(markdownCode.ReplaceAllString(content, "")) {
+		content = markdownToHTML(content)
+	}
+	return template.HTML(sanitize(content))
+}
+
+var (
+	looksLikeHTML = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	//tags in code are markdown showing off html not html.
+	markdownCode = regexp.MustCompile("(?s)```.*?```|`[^`\n]*`")
+)
+
+//elements we keep and the attributes they can keep.
+var allowedTags = map[atom.Atom][]string{
+	atom.P: nil, atom.Br: nil, atom.Hr: nil,
+	atom.B: nil, atom.Strong: nil, atom.I: nil, atom.Em: nil, atom.Del: nil,
+	atom.Code: nil, atom.Pre: nil, atom.Blockquote: nil,
+	atom.Ul: nil, atom.Ol: nil, atom.Li: nil,
+	atom.H1: nil, atom.H2: nil, atom.H3: nil, atom.H4: nil, atom.H5: nil, atom.H6: nil,
+	atom.A:   {"href", "title"},
+	atom.Img: {"src", "alt", "title", "width", "height"},
+}
+
+//elements that take their contents with them. Anything else not allowed is unwrapped and keeps its text.
+var droppedTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Template: true, atom.Noscript: true,
+	atom.Iframe: true, atom.Frame: true, atom.Frameset: true, atom.Object: true, atom.Embed: true, atom.Applet: true,
+	atom.Textarea: true, atom.Select: true, atom.Title: true, atom.Head: true,
+	atom.Xmp: true, atom.Noembed: true, atom.Noframes: true, atom.Plaintext: true,
+	atom.Svg: true, atom.Math: true,
+	atom.Base: true, atom.Link: true, atom.Meta: true,
+}
+
+//schemes a link can use. Images can't be mailto.
+var (
+	linkSchemes  = []string{"http", "https", "mailto"}
+	imageSchemes = []string{"http", "https"}
+)
+
+func sanitize(content string) string {
+	root := &nethtml.Node{Type: nethtml.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := nethtml.ParseFragment(strings.NewReader(content), &nethtml.Node{Type: nethtml.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		//the parser is supposed to cope with anything so this shouldn't happen but if it does show it as text.
+		return html.EscapeString(content)
+	}
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
+	sanitizeChildren(root)
+	var out strings.Builder
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if err := nethtml.Render(&out, c); err != nil {
+			return html.EscapeString(content)
+		}
+	}
+	return out.String()
+}
+
+func sanitizeChildren(parent *nethtml.Node) {
+	for c := parent.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == nethtml.TextNode:
+		case c.Type != nethtml.ElementNode || c.Namespace != "" || droppedTags[c.DataAtom]:
+			parent.RemoveChild(c)
+		default:
+			sanitizeChildren(c)
+			if _, allowed := allowedTags[c.DataAtom]; !allowed {
+				//keep the text but lose the tag.
+				for gc := c.FirstChild; gc != nil; gc = c.FirstChild {
+					c.RemoveChild(gc)
+					parent.InsertBefore(gc, c)
+				}
+				parent.RemoveChild(c)
+			} else if !sanitizeAttrs(c) {
+				parent.RemoveChild(c)
+			}
+		}
+		c = next
+	}
+}
+
+//keeps only allowed attributes with safe urls. False means the element is useless and should go.
+func sanitizeAttrs(n *nethtml.Node) bool {
+	allowed := allowedTags[n.DataAtom]
+	kept := []nethtml.Attribute{}
+	for _, a := range n.Attr {
+		if a.Namespace != "" || !contains(allowed, a.Key) {
+			continue
+		}
+		switch a.Key {
+		case "href":
+			u, ok := safeURL(a.Val, linkSchemes)
+			if !ok {
+				continue
+			}
+			a.Val = u
+		case "src":
+			u, ok := safeURL(a.Val, imageSchemes)
+			if !ok {
+				continue
+			}
+			a.Val = u
+		}
+		kept = append(kept, a)
+	}
+	n.Attr = kept
+	switch n.DataAtom {
+	case atom.A:
+		//anyone can post so don't lend them our reputation or window.opener.
+		n.Attr = append(n.Attr, nethtml.Attribute{Key: "rel", Val: "nofollow noopener ugc"})
+	case atom.Img:
+		return hasAttr(n, "src")
+	}
+	return true
+}
+
+//safeURL allows our own paths and the given schemes. Browsers ignore tabs, newlines and leading junk so we do too before checking.
+func safeURL(raw string, schemes []string) (string, bool) {
+	clean := strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, raw)
+	clean = strings.TrimFunc(clean, func(r rune) bool { return r <= ' ' })
+	if strings.Contains(clean, `\`) {
+		return "", false
+	}
+	if strings.HasPrefix(clean, "/") && !strings.HasPrefix(clean, "//") {
+		return clean, true
+	}
+	u, err := url.Parse(clean)
+	if err != nil || !contains(schemes, strings.ToLower(u.Scheme)) {
+		return "", false
+	}
+	return u.String(), true
+}
+
+func hasAttr(n *nethtml.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	heading    = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	listItem   = regexp.MustCompile(`^[-*+]\s+(.*)$`)
+	quoteLine  = regexp.MustCompile(`^&gt;\s?(.*)$`) //after escaping
+	inlineSpan = regexp.MustCompile("`([^`]+)`" + `|\[([^\]]+)\]\(([^)\s]+)\)|(https?://[^\s<]+)`)
+	strong     = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	emphasis   = regexp.MustCompile(`\*([^*]+)\*`)
+)
+
+//markdownToHTML handles the bits of markdown people actually use in posts.
+//Everything is escaped first so the only tags in the output are the ones we write.
+func markdownToHTML(src string) string {
+	var out strings.Builder
+	var para, items, quote, code []string
+	inCode := false
+
+	flush := func() {
+		if len(para) > 0 {
+			out.WriteString("<p>" + strings.Join(para, "<br>\n") + "</p>\n")
+			para = nil
+		}
+		if len(items) > 0 {
+			out.WriteString("<ul>")
+			for _, i := range items {
+				out.WriteString("<li>" + i + "</li>")
+			}
+			out.WriteString("</ul>\n")
+			items = nil
+		}
+		if len(quote) > 0 {
+			out.WriteString("<blockquote>" + strings.Join(quote, "<br>\n") + "</blockquote>\n")
+			quote = nil
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			if inCode {
+				out.WriteString("<pre><code>" + strings.Join(code, "\n") + "</code></pre>\n")
+				code = nil
+			} else {
+				flush()
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			code = append(code, html.EscapeString(line))
+			continue
+		}
+		trimmed = html.EscapeString(trimmed)
+		if m := heading.FindStringSubmatch(trimmed); m != nil {
+			flush()
+			level := string(rune('0' + len(m[1])))
+			out.WriteString("<h" + level + ">" + inline(m[2]) + "</h" + level + ">\n")
+			continue
+		}
+		if m := listItem.FindStringSubmatch(trimmed); m != nil {
+			if len(para) > 0 || len(quote) > 0 {
+				flush()
+			}
+			items = append(items, inline(m[1]))
+			continue
+		}
+		if m := quoteLine.FindStringSubmatch(trimmed); m != nil {
+			if len(para) > 0 || len(items) > 0 {
+				flush()
+			}
+			quote = append(quote, inline(m[1]))
+			continue
+		}
+		if trimmed == "" {
+			flush()
+			continue
+		}
+		if len(items) > 0 || len(quote) > 0 {
+			flush()
+		}
+		para = append(para, inline(trimmed))
+	}
+	if inCode {
+		//unclosed fence, show what we have.
+		out.WriteString("<pre><code>" + strings.Join(code, "\n") + "</code></pre>\n")
+	}
+	flush()
+	return out.String()
+}
+
+//inline does code spans, links, emphasis, hashtags and mentions on already escaped text.
+func inline(text string) string {
+	var out strings.Builder
+	last := 0
+	for _, m := range inlineSpan.FindAllStringSubmatchIndex(text, -1) {
+		out.WriteString(linkMentions(linkTags(emphasize(text[last:m[0]]))))
+		switch {
+		case m[2] >= 0:
+			out.WriteString("<code>" + text[m[2]:m[3]] + "</code>")
+		case m[4] >= 0:
+			out.WriteString(`<a href="` + text[m[6]:m[7]] + `">` + emphasize(text[m[4]:m[5]]) + "</a>")
+		default:
+			//trailing punctuation is almost always the sentence not the url.
+			url := text[m[8]:m[9]]
+			trimmed := strings.TrimRight(url, ".,;:!?)")
+			out.WriteString(`<a href="` + trimmed + `">` + trimmed + "</a>" + url[len(trimmed):])
+		}
+		last = m[1]
+	}
+	out.WriteString(linkMentions(linkTags(emphasize(text[last:]))))
+	return out.String()
+}
+
+//hashtags link to their topic feed. Not done inside links or code.
+func linkTags(text string) string {
+	return hashtag.ReplaceAllStringFunc(text, func(match string) string {
+		m := hashtag.FindStringSubmatch(match)
+		return m[1] + `<a href="/tag/` + url.PathEscape(NormalizeTag(m[2])) + `">#` + m[2] + "</a>"
+	})
+}
+
+//mentions link to the account. Bare names don't because we don't know who they are.
+func linkMentions(text string) string {
+	return mention.ReplaceAllStringFunc(text, func(match string) string {
+		m := mention.FindStringSubmatch(match)
+		if !mentionable(m[2]) {
+			return match
+		}
+		return m[1] + `<a href="/user/` + url.PathEscape(m[2]) + `">@` + m[2] + "</a>"
+	})
+}
+
+func emphasize(text string) string {
+	text = strong.ReplaceAllString(text, "<strong>$1</strong>")
+	return emphasis.ReplaceAllString(text, "<em>$1</em>")
+}
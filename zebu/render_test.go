@@ -0,0 +1,135 @@
+package zebu
+
+import (
+	"strings"
+	"testing"
+
+	nethtml "golang.org/x/net/html"
+)
+
+//payloads from the owasp cheat sheet and friends. None of them should come out able to run anything.
+var xssCorpus = []string{
+	`<script>alert(1)</script>`,
+	`<SCRIPT SRC=http://xss.rocks/xss.js></SCRIPT>`,
+	`<img src=x onerror=alert(1)>`,
+	`<IMG SRC="javascript:alert('XSS');">`,
+	`<IMG SRC=JaVaScRiPt:alert('XSS')>`,
+	`<IMG SRC=&#106;&#97;&#118;&#97;&#115;&#99;&#114;&#105;&#112;&#116;&#58;&#97;&#108;&#101;&#114;&#116;&#40;&#39;&#88;&#83;&#83;&#39;&#41;>`,
+	`<IMG SRC="jav	ascript:alert('XSS');">`,
+	`<IMG SRC="jav&#x0A;ascript:alert('XSS');">`,
+	`<IMG SRC=" &#14;  javascript:alert('XSS');">`,
+	`<a href="javascript:alert(1)">click</a>`,
+	`<a href="  JAVASCRIPT:alert(1)">click</a>`,
+	`<a href="vbscript:msgbox(1)">click</a>`,
+	`<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">click</a>`,
+	`<a href="/\evil.com">click</a>`,
+	`<a href="x" onclick="alert(1)">click</a>`,
+	`<a href="https://ok" target="_blank" rel="opener">click</a>`,
+	`<svg/onload=alert(1)>`,
+	`<svg><script>alert(1)</script></svg>`,
+	`<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`,
+	`<iframe src="javascript:alert(1)"></iframe>`,
+	`<iframe srcdoc="<script>alert(1)</script>"></iframe>`,
+	`<object data="javascript:alert(1)"></object>`,
+	`<embed src="javascript:alert(1)">`,
+	`<body onload=alert(1)>`,
+	`<div style="background:url(javascript:alert(1))">x</div>`,
+	`<style>@import 'http://evil/xss.css';</style>`,
+	`<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`,
+	`<base href="javascript:alert(1)//">`,
+	`<form action="javascript:alert(1)"><button formaction="javascript:alert(1)">x</button></form>`,
+	`<input onfocus=alert(1) autofocus>`,
+	`<details open ontoggle=alert(1)>`,
+	`<noscript><p title="</noscript><img src=x onerror=alert(1)>">`,
+	`<template><img src=x onerror=alert(1)></template>`,
+	`<xmp><img src=x onerror=alert(1)></xmp>`,
+	`<!--<img src=x onerror=alert(1)>-->`,
+	`<<script>alert(1);//<</script>`,
+	`<scr<script>ipt>alert(1)</script>`,
+	`<a href="https://ok">fine</a><img src="http://ok/x.png" onload=alert(1)>`,
+	"[click](javascript:alert(1))",
+	"[click](  javascript:alert(1))",
+	"[click](data:text/html,<script>alert(1)</script>)",
+	"**<img src=x onerror=alert(1)>**",
+	"`<script>alert(1)</script>`",
+	"```\n<script>alert(1)</script>\n```",
+	"# <svg onload=alert(1)>",
+	"> <iframe src=javascript:alert(1)>",
+	`[x](https://ok" onmouseover="alert(1))`,
+	"https://ok/\"><script>alert(1)</script>",
+}
+
+var unsafeElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true, "svg": true, "math": true,
+	"meta": true, "base": true, "link": true, "form": true, "input": true, "button": true, "template": true,
+	"noscript": true, "xmp": true, "details": true, "body": true,
+}
+
+//checkSafe parses rendered output the way a browser would and looks for anything that could run.
+func checkSafe(t *testing.T, payload string, rendered string) {
+	t.Helper()
+	doc, err := nethtml.Parse(strings.NewReader(rendered))
+	if err != nil {
+		t.Fatalf("%q rendered unparseable %q", payload, rendered)
+	}
+	var walk func(n *nethtml.Node)
+	walk = func(n *nethtml.Node) {
+		if n.Type == nethtml.ElementNode && n.Parent != nil && n.Parent.Type != nethtml.DocumentNode && n.Data != "head" && n.Data != "body" {
+			if unsafeElements[n.Data] {
+				t.Errorf("%q rendered a %s: %q", payload, n.Data, rendered)
+			}
+			for _, a := range n.Attr {
+				switch {
+				case strings.HasPrefix(a.Key, "on"), a.Key == "style", a.Key == "srcdoc", a.Key == "formaction", a.Key == "target":
+					t.Errorf("%q kept %s: %q", payload, a.Key, rendered)
+				case a.Key == "href" || a.Key == "src":
+					if _, ok := safeURL(a.Val, linkSchemes); !ok {
+						t.Errorf("%q kept unsafe url %s: %q", payload, a.Val, rendered)
+					}
+				case a.Key == "rel" && strings.Contains(a.Val, "opener") && !strings.Contains(a.Val, "noopener"):
+					t.Errorf("%q kept rel %s", payload, a.Val)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+}
+
+func TestRenderXSS(t *testing.T) {
+	for _, payload := range xssCorpus {
+		checkSafe(t, payload, string(Render(payload)))
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	cases := map[string]string{
+		"hello *world*":                "<p>hello <em>world</em></p>\n",
+		"**bold** and `a < b`":         "<p><strong>bold</strong> and <code>a &lt; b</code></p>\n",
+		"one\ntwo\n\nthree":            "<p>one<br/>\ntwo</p>\n<p>three</p>\n",
+		"# title\n- a\n- b":            "<h1>title</h1>\n<ul><li>a</li><li>b</li></ul>\n",
+		"> quoted":                     "<blockquote>quoted</blockquote>\n",
+		"see https://northbriton.net.": `<p>see <a href="https://northbriton.net" rel="nofollow noopener ugc">https://northbriton.net</a>.</p>` + "\n",
+		"[zebu](https://x/?a=1&b=2)":   `<p><a href="https://x/?a=1&amp;b=2" rel="nofollow noopener ugc">zebu</a></p>` + "\n",
+		"```\n<b>not bold</b>\n```":    "<pre><code>&lt;b&gt;not bold&lt;/b&gt;</code></pre>\n",
+		"#hashtag isn't a heading":     `<p><a href="/tag/hashtag" rel="nofollow noopener ugc">#hashtag</a> isn&#39;t a heading</p>` + "\n",
+		"*#Zebu* [#no](https://x/#y)":  `<p><em><a href="/tag/zebu" rel="nofollow noopener ugc">#Zebu</a></em> <a href="https://x/#y" rel="nofollow noopener ugc">#no</a></p>` + "\n",
+		"i <3 zebu":                    "<p>i &lt;3 zebu</p>\n",
+		"hi @Paul.eth, me@x.com @bare": `<p>hi <a href="/user/Paul.eth" rel="nofollow noopener ugc">@Paul.eth</a>, me@x.com @bare</p>` + "\n",
+	}
+	for md, want := range cases {
+		if got := string(Render(md)); got != want {
+			t.Errorf("Render(%q)\n got %q\nwant %q", md, got, want)
+		}
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	got := string(Render(`<p>an <a href="https://example.com/post">rss</a> item <span>with</span> <img src="https://example.com/a.png" alt="a"></p>`))
+	want := `<p>an <a href="https://example.com/post" rel="nofollow noopener ugc">rss</a> item with <img src="https://example.com/a.png" alt="a"/></p>`
+	if got != want {
+		t.Fatalf("got %q\nwant %q", got, want)
+	}
+}
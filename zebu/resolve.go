@@ -1,18 +1,20 @@
 package zebu
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ipfs/go-dnslink"
-	"github.com/wealdtech/go-ens/v3"
+	"golang.org/x/net/dns/dnsmessage"
 )
 
 //other options https://eth.link/ doesn't actually support direct address resolution?
@@ -35,41 +37,34 @@ import (
 
 var NoEthEndpoint = errors.New("ETHENDPOINT not defined")
 
-func resolveEns(ensdomain string) (string, error) {
-	//obviusly need a light client but
-	ethendpoint := os.Getenv("ETHENDPOINT")
-	if ethendpoint == "" {
-		return "", NoEthEndpoint
-	}
+//DNSLinkResolver looks names up in their _dnslink TXT records and gives out names under northbriton.net.
+type DNSLinkResolver struct {
+	//where northbriton's reserve api is.
+	registerEndpoint string
+	cache            *ResolverCache
+}
 
-	client, err := ethclient.Dial(ethendpoint)
-	if err != nil {
-		return "", err
-	}
+func NewDNSLinkResolver(registerEndpoint string) *DNSLinkResolver {
+	return &DNSLinkResolver{registerEndpoint: registerEndpoint, cache: NewResolverCache(lookupDns)}
+}
 
-	// Resolve a name to an address
-	resolver, err := ens.NewResolver(client, ensdomain)
-	if err != nil {
-		return "", err
-	}
-	addr, err := resolver.Address()
-	if err != nil {
-		return "", err
-	}
-	/*hash, err := resolver.Contenthash()
-	if err != nil {
-		return "", err
-	}
-	readablehash, err := ens.ContenthashToString(hash)
-	if err != nil {
-		return "", err
-	}
-	log.Printf("Content hash of %s is %s\n", ensdomain, readablehash)*/
-	return addr.String(), nil
+func (d *DNSLinkResolver) Name() string { return "dnslink" }
+
+//anything with a dot might be a domain. Put it last in the chain.
+func (d *DNSLinkResolver) Handles(id string) bool {
+	return strings.Contains(id, ".")
+}
+
+func (d *DNSLinkResolver) Resolve(id string) (string, error) {
+	return d.cache.Resolve(id)
+}
 
+func (d *DNSLinkResolver) Forget(name string) {
+	d.cache.Forget(name)
 }
 
-func RegisterDNS(displayname, publicname string) (string, error) {
+//Register points displayname.northbriton.net at publicname. Doing it again for the same key is fine.
+func (d *DNSLinkResolver) Register(displayname, publicname string) (string, error) {
 	fqdn := displayname + ".northbriton.net"
 	current, err := resolveDns(fqdn)
 	if err == nil {
@@ -84,13 +79,7 @@ func RegisterDNS(displayname, publicname string) (string, error) {
 		return "", err
 	}
 
-	//turn off on non prod
-	endpoint, ok := os.LookupEnv("REGISTERENDPOINT")
-	if !ok {
-		endpoint = "northbriton"
-	}
-
-	url := fmt.Sprintf("http://%s/reserve/%s", endpoint, displayname)
+	url := fmt.Sprintf("http://%s/reserve/%s", d.registerEndpoint, displayname)
 	req, err := http.NewRequest(http.MethodPut, url, strings.NewReader(publicname))
 	if err != nil {
 		return "", err
@@ -103,8 +92,9 @@ func RegisterDNS(displayname, publicname string) (string, error) {
 		body, _ := ioutil.ReadAll(resp.Body)
 		return "", fmt.Errorf("got %d : %s", resp.StatusCode, string(body))
 	}
+	d.cache.Forget(fqdn)
 	//get this out of body?
-	return displayname + ".northbriton.net", nil
+	return fqdn, nil
 }
 
 const legacyipnsprefix = "/ipns"
@@ -113,51 +103,191 @@ var DNSNotFound = errors.New("DNSNOTFOUND")
 
 //looksup dnslionk subdomains  and pulls out /zebu or /ipfs (legacy) TXT records
 func resolveDns(dnsname string) (string, error) {
-	txts, err := net.LookupTXT("_dnslink." + dnsname)
+	key, _, err := lookupDns(dnsname)
+	return key, err
+}
+
+//go's resolver doesn't tell you ttls so we ask the nameservers in resolv.conf ourselves.
+const (
+	resolvConf = "/etc/resolv.conf"
+	dnsTimeout = 5 * time.Second
+	//what we say when the answer didn't come with a ttl.
+	defaultDNSTTL = 5 * time.Minute
+)
+
+//lookupDns is resolveDns with how long the answer is good for. Not found comes with
+//how long the zone says to remember that (its SOA minimum) so it can be cached too.
+func lookupDns(dnsname string) (string, time.Duration, error) {
+	txts, ttl, err := lookupTXT("_dnslink." + dnsname)
 	if err != nil {
-		log.Printf("failed to find _dnslink." + dnsname)
-		derr := err.(*net.DNSError)
-		if derr.IsNotFound {
-			return "", DNSNotFound
-		}
-		return "", err
+		log.Printf("failed to find _dnslink.%s, %s", dnsname, err)
+		return "", ttl, err
 	}
 	link := ""
 	for _, t := range txts {
-		link, err = dnslink.ParseTXT(t)
-		if err == nil {
+		parsed, err := dnslink.ParseTXT(t)
+		if err != nil {
+			log.Printf("invalid dns link %s", t)
 			continue
 		}
-		log.Printf("invalid dns link %s", t)
-	}
-
-	if link == "" {
-		return "", DNSNotFound
+		if link == "" {
+			link = parsed
+		}
 	}
 
 	if strings.HasPrefix(link, centraltopic) {
-		return link[len(centraltopic)+1:], nil
+		return link[len(centraltopic)+1:], ttl, nil
 	}
 	//remove after we swith over.
 	if strings.HasPrefix(link, legacyipnsprefix) {
-		return link[len(legacyipnsprefix)+1:], nil
+		return link[len(legacyipnsprefix)+1:], ttl, nil
 	}
 	log.Printf("link %s didn't match prefixes", link)
-	return "", DNSNotFound
+	return "", ttl, DNSNotFound
 }
 
-//resolves tries a couple strategy to resolve a user to an eth acccount
-func Resolve(id string) (string, error) {
+func lookupTXT(name string) ([]string, time.Duration, error) {
+	servers, err := nameservers()
+	if err != nil {
+		//no resolv.conf we can read so let go work it out and guess the ttl.
+		txts, err := net.LookupTXT(name)
+		if derr, ok := err.(*net.DNSError); ok && derr.IsNotFound {
+			return nil, defaultDNSTTL, DNSNotFound
+		}
+		return txts, defaultDNSTTL, err
+	}
+	var resp dnsmessage.Message
+	for _, server := range servers {
+		resp, err = queryTXT(server, name)
+		if err == nil && resp.RCode != dnsmessage.RCodeServerFailure {
+			break
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return txtAnswer(name, resp)
+}
+
+//txtAnswer is the TXT records in resp and the shortest ttl of them.
+func txtAnswer(name string, resp dnsmessage.Message) ([]string, time.Duration, error) {
+	switch resp.RCode {
+	case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+	default:
+		return nil, 0, fmt.Errorf("looking up %s got %s", name, resp.RCode)
+	}
 
-	//nothing to do here.
-	if strings.HasPrefix(id, "0x") {
-		return id, nil
+	txts := []string{}
+	ttl := time.Duration(-1)
+	for _, rr := range resp.Answers {
+		txt, ok := rr.Body.(*dnsmessage.TXTResource)
+		if !ok {
+			continue
+		}
+		txts = append(txts, strings.Join(txt.TXT, ""))
+		if t := time.Duration(rr.Header.TTL) * time.Second; ttl < 0 || t < ttl {
+			ttl = t
+		}
 	}
+	if len(txts) > 0 {
+		return txts, ttl, nil
+	}
+	//https://www.rfc-editor.org/rfc/rfc2308#section-5 negative answers last as long as the SOA says.
+	ttl = defaultDNSTTL
+	for _, rr := range resp.Authorities {
+		if soa, ok := rr.Body.(*dnsmessage.SOAResource); ok {
+			ttl = time.Duration(soa.MinTTL) * time.Second
+			if header := time.Duration(rr.Header.TTL) * time.Second; header < ttl {
+				ttl = header
+			}
+		}
+	}
+	return nil, ttl, DNSNotFound
+}
+
+//nameservers reads resolv.conf about the way go's own resolver does.
+func nameservers() ([]string, error) {
+	conf, err := ioutil.ReadFile(resolvConf)
+	if err != nil {
+		return nil, err
+	}
+	servers := []string{}
+	for _, line := range strings.Split(string(conf), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, net.JoinHostPort(fields[1], "53"))
+		}
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no nameservers in %s", resolvConf)
+	}
+	return servers, nil
+}
 
-	//add some caching?
-	if strings.HasSuffix(id, ".eth") {
-		return resolveEns(id)
+//queryTXT asks server for name's TXT records over udp and again over tcp if they don't fit.
+func queryTXT(server, name string) (dnsmessage.Message, error) {
+	qname, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return dnsmessage.Message{}, err
+	}
+	id := make([]byte, 2)
+	if _, err := rand.Read(id); err != nil {
+		return dnsmessage.Message{}, err
+	}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: binary.BigEndian.Uint16(id), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return dnsmessage.Message{}, err
+	}
+	var resp dnsmessage.Message
+	for _, network := range []string{"udp", "tcp"} {
+		data, err := exchange(network, server, packed)
+		if err != nil {
+			return resp, err
+		}
+		if err := resp.Unpack(data); err != nil {
+			return resp, err
+		}
+		if !resp.Response || resp.ID != query.ID {
+			return resp, fmt.Errorf("%s sent a reply to something else", server)
+		}
+		if !resp.Truncated {
+			break
+		}
+	}
+	return resp, nil
+}
+
+func exchange(network, server string, query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout(network, server, dnsTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(dnsTimeout))
+	if network == "udp" {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		resp := make([]byte, 4096)
+		n, err := conn.Read(resp)
+		return resp[:n], err
+	}
+	//tcp messages are prefixed with their length.
+	framed := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(framed, uint16(len(query)))
+	copy(framed[2:], query)
+	if _, err := conn.Write(framed); err != nil {
+		return nil, err
+	}
+	length := make([]byte, 2)
+	if _, err := io.ReadFull(conn, length); err != nil {
+		return nil, err
 	}
-	//fall back to dns last.
-	return resolveDns(id)
+	resp := make([]byte, binary.BigEndian.Uint16(length))
+	_, err = io.ReadFull(conn, resp)
+	return resp, err
 }
@@ -1,12 +1,13 @@
 package zebu
 
 import (
+	"os"
 	"testing"
 )
 
 func TestResolveDNS(t *testing.T) {
 	testdomain := "johnwilkes.northbriton.net"
-	a, err := Resolve(testdomain)
+	a, err := NewDNSLinkResolver("northbriton").Resolve(testdomain)
 	if err != nil {
 		t.Fatal("didn't find dns")
 	}
@@ -17,12 +18,16 @@ func TestResolveDNS(t *testing.T) {
 }
 
 func TestResolveEns(t *testing.T) {
-	testdomain := "northbriton.eth"
-	a, err := Resolve(testdomain)
+	endpoint := os.Getenv("ETHENDPOINT")
+	if endpoint == "" {
+		t.Skip("ETHENDPOINT not defined")
+	}
+	client, err := DialEns(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewEnsResolver(client).Resolve("northbriton.eth")
 	if err != nil {
-		if err == NoEthEndpoint {
-			return
-		}
 		t.Fatalf("didn't find ens, %v", err)
 	}
 	if a != account {
@@ -31,7 +36,7 @@ func TestResolveEns(t *testing.T) {
 }
 
 func TestResolveNoop(t *testing.T) {
-	a, err := Resolve(account)
+	a, err := NewResolverChain(KeyResolver{}).Resolve(account)
 	if err != nil {
 		t.Fatalf("didn't noop, %v", err)
 	}
@@ -42,13 +47,13 @@ func TestResolveNoop(t *testing.T) {
 
 //just test we handle already registered dns and error correctly. Hard to unittest in isolation
 func TestRegisterDns(t *testing.T) {
-
-	_, err := RegisterDNS("johnwilkes", account)
+	dns := NewDNSLinkResolver("northbriton")
+	_, err := dns.Register("johnwilkes", account)
 	if err != nil {
 		t.Fatalf("didn't noop for same account, %v", err)
 	}
 
-	_, err = RegisterDNS("johnwilkes", "0xDEADBEEF")
+	_, err = dns.Register("johnwilkes", "0xDEADBEEF")
 	if err == nil {
 		t.Fatalf("didn't fail for wrong account, %v", err)
 	}
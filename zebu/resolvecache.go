@@ -0,0 +1,147 @@
+package zebu
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+//Lookup finds the key for a name and how long the answer is good for. An error with a ttl is a definite
+//not found that can be remembered, an error without one (the network, no ETHENDPOINT) is tried again next time.
+type Lookup func(name string) (key string, ttl time.Duration, err error)
+
+//some records say a second and some say a week. Keep them within reason.
+const (
+	minResolveTTL  = 30 * time.Second
+	maxResolveTTL  = time.Hour
+	maxNegativeTTL = 5 * time.Minute //someone who just registered shouldn't wait an hour to exist.
+	//past this many names we sweep out expired ones when adding.
+	resolveCacheSweep = 10000
+)
+
+type resolved struct {
+	key     string
+	expires time.Time
+}
+
+type notResolved struct {
+	err     error
+	expires time.Time
+}
+
+//a lookup in progress that others asking for the same name wait on.
+type lookupCall struct {
+	done chan struct{}
+	key  string
+	err  error
+}
+
+//ResolverCache remembers what names resolved to for as long as their records say. Not founds are kept
+//separately and for less time. Lots of requests for a name nobody has looked up yet share one lookup.
+type ResolverCache struct {
+	lookup Lookup
+	now    func() time.Time
+
+	lock     sync.Mutex
+	found    map[string]resolved
+	missing  map[string]notResolved
+	inflight map[string]*lookupCall
+}
+
+func NewResolverCache(lookup Lookup) *ResolverCache {
+	return &ResolverCache{
+		lookup:   lookup,
+		now:      time.Now,
+		found:    map[string]resolved{},
+		missing:  map[string]notResolved{},
+		inflight: map[string]*lookupCall{},
+	}
+}
+
+//Resolve is lookup with a memory.
+func (r *ResolverCache) Resolve(id string) (string, error) {
+	//dns and ens names and addresses don't care about case.
+	name := strings.ToLower(id)
+
+	r.lock.Lock()
+	now := r.now()
+	if f, found := r.found[name]; found && now.Before(f.expires) {
+		r.lock.Unlock()
+		resolveCacheCount.WithLabelValues("hit").Inc()
+		return f.key, nil
+	}
+	if m, found := r.missing[name]; found && now.Before(m.expires) {
+		r.lock.Unlock()
+		resolveCacheCount.WithLabelValues("negative").Inc()
+		return "", m.err
+	}
+	if call, found := r.inflight[name]; found {
+		r.lock.Unlock()
+		resolveCacheCount.WithLabelValues("coalesced").Inc()
+		<-call.done
+		return call.key, call.err
+	}
+	call := &lookupCall{done: make(chan struct{})}
+	r.inflight[name] = call
+	r.lock.Unlock()
+	resolveCacheCount.WithLabelValues("miss").Inc()
+
+	start := time.Now()
+	key, ttl, err := r.lookup(name)
+	result := "found"
+	if err != nil {
+		result = "error"
+	}
+	resolveHist.WithLabelValues(result).Observe(time.Since(start).Seconds())
+
+	r.lock.Lock()
+	delete(r.inflight, name)
+	now = r.now()
+	if len(r.found)+len(r.missing) > resolveCacheSweep {
+		r.sweep(now)
+	}
+	switch {
+	case err == nil:
+		r.found[name] = resolved{key, now.Add(clamp(ttl, minResolveTTL, maxResolveTTL))}
+		delete(r.missing, name)
+	case ttl > 0:
+		r.missing[name] = notResolved{err, now.Add(clamp(ttl, minResolveTTL, maxNegativeTTL))}
+	}
+	r.lock.Unlock()
+
+	call.key, call.err = key, err
+	close(call.done)
+	return key, err
+}
+
+//Forget drops anything we know about name. For when we know it's changed like having just registered it.
+func (r *ResolverCache) Forget(name string) {
+	name = strings.ToLower(name)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.found, name)
+	delete(r.missing, name)
+}
+
+func (r *ResolverCache) sweep(now time.Time) {
+	for name, f := range r.found {
+		if !now.Before(f.expires) {
+			delete(r.found, name)
+		}
+	}
+	for name, m := range r.missing {
+		if !now.Before(m.expires) {
+			delete(r.missing, name)
+		}
+	}
+}
+
+func clamp(ttl, min, max time.Duration) time.Duration {
+	if ttl < min {
+		return min
+	}
+	if ttl > max {
+		return max
+	}
+	return ttl
+}
@@ -0,0 +1,179 @@
+package zebu
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+//fakeLookup answers from a map and counts how often it's asked.
+type fakeLookup struct {
+	keys    map[string]string
+	ttl     time.Duration
+	calls   int32
+	release chan struct{} //if set lookups wait for it
+}
+
+var errFlaky = errors.New("network down")
+
+func (f *fakeLookup) lookup(name string) (string, time.Duration, error) {
+	atomic.AddInt32(&f.calls, 1)
+	if f.release != nil {
+		<-f.release
+	}
+	if name == "flaky.eth" {
+		return "", 0, errFlaky
+	}
+	key, found := f.keys[name]
+	if !found {
+		return "", f.ttl, DNSNotFound
+	}
+	return key, f.ttl, nil
+}
+
+func TestResolverCacheTTL(t *testing.T) {
+	fake := &fakeLookup{keys: map[string]string{"alice.northbriton.net": "0xA11CE"}, ttl: 2 * time.Minute}
+	cache := NewResolverCache(fake.lookup)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	for _, name := range []string{"alice.northbriton.net", "Alice.Northbriton.net"} {
+		key, err := cache.Resolve(name)
+		if err != nil || key != "0xA11CE" {
+			t.Fatalf("resolved %s to %s, %v", name, key, err)
+		}
+	}
+	if fake.calls != 1 {
+		t.Fatalf("expected one lookup got %d", fake.calls)
+	}
+
+	now = now.Add(2*time.Minute + time.Second)
+	cache.Resolve("alice.northbriton.net")
+	if fake.calls != 2 {
+		t.Fatalf("expected a lookup after the ttl got %d", fake.calls)
+	}
+
+	//not founds are kept but not for as long as the record says.
+	fake.ttl = 24 * time.Hour
+	if _, err := cache.Resolve("bob.northbriton.net"); err != DNSNotFound {
+		t.Fatalf("expected not found got %v", err)
+	}
+	if _, err := cache.Resolve("bob.northbriton.net"); err != DNSNotFound || fake.calls != 3 {
+		t.Fatalf("expected a cached not found got %v after %d lookups", err, fake.calls)
+	}
+	fake.keys["bob.northbriton.net"] = "0xB0B"
+	now = now.Add(maxNegativeTTL + time.Second)
+	if key, err := cache.Resolve("bob.northbriton.net"); err != nil || key != "0xB0B" {
+		t.Fatalf("not found should expire got %s, %v", key, err)
+	}
+
+	//errors that aren't a definite answer aren't remembered.
+	cache.Resolve("flaky.eth")
+	cache.Resolve("flaky.eth")
+	if fake.calls != 6 {
+		t.Fatalf("expected flaky lookups every time got %d", fake.calls)
+	}
+
+	fake.ttl = time.Second
+	cache.Resolve("carol.eth")
+	fake.keys["carol.eth"] = "0xCA201"
+	cache.Forget("carol.eth")
+	if key, _ := cache.Resolve("carol.eth"); key != "0xCA201" {
+		t.Fatalf("forget should drop the not found got %s", key)
+	}
+}
+
+func TestResolverCacheCoalesces(t *testing.T) {
+	fake := &fakeLookup{keys: map[string]string{"alice.eth": "0xA11CE"}, ttl: time.Minute, release: make(chan struct{})}
+	cache := NewResolverCache(fake.lookup)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if key, err := cache.Resolve("alice.eth"); err != nil || key != "0xA11CE" {
+				t.Errorf("resolved %s, %v", key, err)
+			}
+		}()
+	}
+	//let everyone pile up behind the first lookup.
+	for {
+		cache.lock.Lock()
+		waiting := len(cache.inflight)
+		cache.lock.Unlock()
+		if waiting == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(fake.release)
+	wg.Wait()
+	if fake.calls != 1 {
+		t.Fatalf("expected one lookup for everyone got %d", fake.calls)
+	}
+}
+
+func TestQueryTXT(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 512)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var query dnsmessage.Message
+		if err := query.Unpack(buf[:n]); err != nil {
+			return
+		}
+		q := query.Questions[0]
+		header := func(ttl uint32) dnsmessage.ResourceHeader {
+			return dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET, TTL: ttl}
+		}
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.ID, Response: true},
+			Questions: query.Questions,
+			Answers: []dnsmessage.Resource{
+				{Header: header(600), Body: &dnsmessage.TXTResource{TXT: []string{"dnslink=/zebu/", "0xA11CE"}}},
+				{Header: header(300), Body: &dnsmessage.TXTResource{TXT: []string{"v=spf1 -all"}}},
+			},
+		}
+		packed, _ := resp.Pack()
+		conn.WriteTo(packed, addr)
+	}()
+
+	resp, err := queryTXT(conn.LocalAddr().String(), "_dnslink.alice.northbriton.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	txts, ttl, err := txtAnswer("_dnslink.alice.northbriton.net", resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(txts, "|") != "dnslink=/zebu/0xA11CE|v=spf1 -all" || ttl != 5*time.Minute {
+		t.Fatalf("got %v for %s", txts, ttl)
+	}
+
+	soa, _ := dnsmessage.NewName("northbriton.net.")
+	missing := dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true, RCode: dnsmessage.RCodeNameError},
+		Authorities: []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: soa, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: 3600},
+			Body:   &dnsmessage.SOAResource{NS: soa, MBox: soa, MinTTL: 60},
+		}},
+	}
+	if _, ttl, err := txtAnswer("_dnslink.nobody.northbriton.net", missing); err != DNSNotFound || ttl != time.Minute {
+		t.Fatalf("expected not found for the soa minimum got %s, %v", ttl, err)
+	}
+}
@@ -0,0 +1,236 @@
+package zebu
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+//Resolver turns one kind of name into a key. Ones that go over the network should cache, see ResolverCache.
+type Resolver interface {
+	//Name is how we say which resolver answered, in logs, metrics and config.
+	Name() string
+	//Handles is whether id is the kind of name this resolver knows about.
+	Handles(id string) bool
+	Resolve(id string) (string, error)
+}
+
+//Some resolvers can do more than look names up. The chain asks whichever one handles the name.
+type (
+	//Namer goes the other way, from a key to the name it's known by like an ens primary name.
+	Namer interface {
+		NameOf(key string) (string, error)
+	}
+	//Texter has profile records on its names like ens text records.
+	Texter interface {
+		Text(name string, keys ...string) (map[string]string, error)
+	}
+	//Registrar hands out names as well as looking them up like northbriton.net.
+	Registrar interface {
+		Register(displayname, key string) (string, error)
+	}
+	forgetter interface {
+		Forget(name string)
+	}
+)
+
+var ErrNoResolver = errors.New("no resolver for")
+
+//Resolution is a key and which resolver found it.
+type Resolution struct {
+	Key      string
+	Resolver string
+}
+
+//ResolverChain asks the first of its resolvers that handles a name. Order matters, an alias file
+//before dns means a local name wins over a real one.
+type ResolverChain struct {
+	resolvers []Resolver
+}
+
+func NewResolverChain(resolvers ...Resolver) *ResolverChain {
+	return &ResolverChain{resolvers: resolvers}
+}
+
+//Resolvers says who's in the chain in order.
+func (c *ResolverChain) Resolvers() []string {
+	names := []string{}
+	for _, r := range c.resolvers {
+		names = append(names, r.Name())
+	}
+	return names
+}
+
+func (c *ResolverChain) find(id string) (Resolver, error) {
+	for _, r := range c.resolvers {
+		if r.Handles(id) {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %s", ErrNoResolver, id)
+}
+
+//Resolution resolves id and says which resolver did it.
+func (c *ResolverChain) Resolution(id string) (Resolution, error) {
+	r, err := c.find(id)
+	if err != nil {
+		return Resolution{}, err
+	}
+	key, err := r.Resolve(id)
+	result := "found"
+	if err != nil {
+		result = "error"
+	}
+	resolverCount.WithLabelValues(r.Name(), result).Inc()
+	return Resolution{Key: key, Resolver: r.Name()}, err
+}
+
+//Resolve turns a name into a key. Keys are already keys.
+func (c *ResolverChain) Resolve(id string) (string, error) {
+	resolution, err := c.Resolution(id)
+	return resolution.Key, err
+}
+
+//NameOf is what key is called by the first resolver that can say. Empty if nobody knows (or we can't tell).
+func (c *ResolverChain) NameOf(key string) string {
+	for _, r := range c.resolvers {
+		if namer, ok := r.(Namer); ok {
+			if name, err := namer.NameOf(key); err == nil && name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+//Text reads profile records for name from whichever resolver handles it. Missing ones come back empty.
+func (c *ResolverChain) Text(name string, keys ...string) (map[string]string, error) {
+	r, err := c.find(name)
+	if err != nil {
+		return nil, err
+	}
+	texter, ok := r.(Texter)
+	if !ok {
+		return nil, fmt.Errorf("%s names don't have profile records", r.Name())
+	}
+	return texter.Text(name, keys...)
+}
+
+//Register gives key displayname with the first resolver that hands out names and returns the full name.
+func (c *ResolverChain) Register(displayname, key string) (string, error) {
+	for _, r := range c.resolvers {
+		if registrar, ok := r.(Registrar); ok {
+			name, err := registrar.Register(displayname, key)
+			if err != nil {
+				return "", err
+			}
+			//whatever we remembered about the name isn't true any more.
+			c.Forget(name)
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("none of %v can register names", c.Resolvers())
+}
+
+//Forget drops anything cached about name. For when we know it's changed.
+func (c *ResolverChain) Forget(name string) {
+	for _, r := range c.resolvers {
+		if f, ok := r.(forgetter); ok {
+			f.Forget(name)
+		}
+	}
+}
+
+//KeyResolver passes through anything that's already a key we can verify, ethereum addresses mostly.
+type KeyResolver struct{}
+
+func (KeyResolver) Name() string                      { return "address" }
+func (KeyResolver) Handles(id string) bool            { return IsPublicKey(id) }
+func (KeyResolver) Resolve(id string) (string, error) { return id, nil }
+
+//DidPkhResolver reads the address out of a did:pkh, https://github.com/w3c-ccg/did-pkh/blob/main/did-pkh-method-draft.md
+//Only eip155 (ethereum and its chains) since those are the only accounts we can verify.
+type DidPkhResolver struct{}
+
+const didPkhPrefix = "did:pkh:"
+
+func (DidPkhResolver) Name() string { return "did:pkh" }
+
+func (DidPkhResolver) Handles(id string) bool {
+	return strings.HasPrefix(strings.ToLower(id), didPkhPrefix)
+}
+
+func (DidPkhResolver) Resolve(id string) (string, error) {
+	//did:pkh:eip155:1:0xb9c5714089478a327f09197987f16f9e5d936e8a
+	parts := strings.Split(id[len(didPkhPrefix):], ":")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%s isn't namespace:chain:account", id)
+	}
+	if parts[0] != "eip155" {
+		return "", fmt.Errorf("can't use %s accounts only eip155", parts[0])
+	}
+	if !common.IsHexAddress(parts[2]) {
+		return "", fmt.Errorf("%s isn't an ethereum address", parts[2])
+	}
+	return common.HexToAddress(parts[2]).Hex(), nil
+}
+
+//AliasResolver is names we've been told locally. For nicknames and people who don't have dns or ens.
+type AliasResolver struct {
+	aliases map[string]string
+}
+
+func NewAliasResolver(aliases map[string]string) *AliasResolver {
+	a := &AliasResolver{aliases: map[string]string{}}
+	for name, key := range aliases {
+		a.aliases[strings.ToLower(name)] = key
+	}
+	return a
+}
+
+//LoadAliases reads an alias file, a name and a key on each line. Blank lines and ones starting with # are skipped.
+func LoadAliases(path string) (*AliasResolver, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	aliases := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d should be a name and a key", path, line)
+		}
+		if !IsPublicKey(fields[1]) {
+			return nil, fmt.Errorf("%s:%d %s isn't a key", path, line, fields[1])
+		}
+		aliases[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewAliasResolver(aliases), nil
+}
+
+func (a *AliasResolver) Name() string { return "alias" }
+
+func (a *AliasResolver) Handles(id string) bool {
+	_, found := a.aliases[strings.ToLower(id)]
+	return found
+}
+
+func (a *AliasResolver) Resolve(id string) (string, error) {
+	key, found := a.aliases[strings.ToLower(id)]
+	if !found {
+		return "", fmt.Errorf("no alias %s", id)
+	}
+	return key, nil
+}
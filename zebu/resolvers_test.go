@@ -0,0 +1,115 @@
+package zebu
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//fakeResolver answers for names ending in suffix from a map and can register and name things too.
+type fakeResolver struct {
+	name      string
+	suffix    string
+	keys      map[string]string
+	forgotten []string
+}
+
+func (f *fakeResolver) Name() string { return f.name }
+
+func (f *fakeResolver) Handles(id string) bool {
+	return len(id) > len(f.suffix) && id[len(id)-len(f.suffix):] == f.suffix
+}
+
+func (f *fakeResolver) Resolve(id string) (string, error) {
+	if key, found := f.keys[id]; found {
+		return key, nil
+	}
+	return "", DNSNotFound
+}
+
+func (f *fakeResolver) Register(displayname, key string) (string, error) {
+	name := displayname + f.suffix
+	f.keys[name] = key
+	return name, nil
+}
+
+func (f *fakeResolver) Forget(name string) { f.forgotten = append(f.forgotten, name) }
+
+func (f *fakeResolver) NameOf(key string) (string, error) {
+	for name, k := range f.keys {
+		if k == key {
+			return name, nil
+		}
+	}
+	return "", DNSNotFound
+}
+
+func TestResolverChain(t *testing.T) {
+	addr := "0x5AEDA56215b167893e80B4fE645BA6d5Bab767DE"
+	aliasfile := filepath.Join(t.TempDir(), "aliases")
+	err := os.WriteFile(aliasfile, []byte("# friends\nWilkes "+account+"\n\nalice.northbriton.net "+addr+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliases, err := LoadAliases(aliasfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dns := &fakeResolver{name: "dnslink", suffix: ".northbriton.net", keys: map[string]string{"alice.northbriton.net": "0xB0B"}}
+	chain := NewResolverChain(KeyResolver{}, DidPkhResolver{}, aliases, NewEnsResolver(nil), dns)
+
+	cases := map[string]Resolution{
+		addr:                       {addr, "address"},
+		"did:pkh:eip155:1:" + addr: {addr, "did:pkh"},
+		"did:pkh:eip155:137:0x5aeda56215b167893e80b4fe645ba6d5bab767de": {addr, "did:pkh"},
+		"wilkes":                {account, "alias"},
+		"alice.northbriton.net": {addr, "alias"}, //aliases come before dns so they win.
+	}
+	for id, want := range cases {
+		got, err := chain.Resolution(id)
+		if err != nil || got != want {
+			t.Errorf("%s resolved to %v, %v want %v", id, got, err, want)
+		}
+	}
+
+	if _, err := chain.Resolve("did:pkh:solana:4sGjMW1sUnHzSxGspuhpqLDx6wiyjNtZ:7S3P4HxJpyyigGzodYwHtCxZyUQe9JiBMHyRWXArAaKv"); err == nil {
+		t.Errorf("only eip155 accounts can be verified")
+	}
+	if _, err := chain.Resolve("bob.eth"); err != NoEthEndpoint {
+		t.Errorf(".eth without a client should say so not fall through got %v", err)
+	}
+	if _, err := chain.Resolve("nobody"); !errors.Is(err, ErrNoResolver) {
+		t.Errorf("expected no resolver got %v", err)
+	}
+	if r, err := chain.Resolution("carol.northbriton.net"); err != DNSNotFound || r.Resolver != "dnslink" {
+		t.Errorf("expected dnslink not to find carol got %v, %v", r, err)
+	}
+
+	name, err := chain.Register("carol", account)
+	if err != nil || name != "carol.northbriton.net" {
+		t.Fatalf("couldn't register carol, %s, %v", name, err)
+	}
+	if len(dns.forgotten) != 1 || dns.forgotten[0] != name {
+		t.Errorf("registering should forget what we knew about %s got %v", name, dns.forgotten)
+	}
+	if key, err := chain.Resolve(name); err != nil || key != account {
+		t.Errorf("carol should resolve after registering got %s, %v", key, err)
+	}
+	if got := chain.NameOf("0xB0B"); got != "alice.northbriton.net" {
+		t.Errorf("expected 0xB0B to be named by dnslink got %s", got)
+	}
+	if _, err := chain.Text("wilkes", "avatar"); err == nil {
+		t.Errorf("aliases don't have profile records")
+	}
+}
+
+func TestLoadAliasesRejectsNonKeys(t *testing.T) {
+	aliasfile := filepath.Join(t.TempDir(), "aliases")
+	if err := os.WriteFile(aliasfile, []byte("wilkes wilkes.eth\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAliases(aliasfile); err == nil {
+		t.Fatalf("aliases should point at keys not other names")
+	}
+}
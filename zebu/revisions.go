@@ -0,0 +1,159 @@
+package zebu
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+const (
+	//Target replaces the content and images of an earlier post.
+	EditPost = "edit"
+	//Target should be hidden and unpinned by nodes that honor it.
+	DeletePost = "delete"
+)
+
+//IsTombstone is true for posts that only exist to change an earlier post and shouldn't be shown themselves.
+func (p Post) IsTombstone() bool {
+	return p.Kind == EditPost || p.Kind == DeletePost || p.Kind == MergePost
+}
+
+//revisions remembers edits and deletes while walking a chain newest first.
+//since an edit always comes after what it edits we've always seen it by the time we get to the target.
+type revisions struct {
+	edits   map[string]FetchedPost
+	deleted map[string]bool
+}
+
+func newRevisions() *revisions {
+	return &revisions{edits: map[string]FetchedPost{}, deleted: map[string]bool{}}
+}
+
+//apply returns the latest revision of p and whether it should be shown at all.
+func (r *revisions) apply(p FetchedPost) (FetchedPost, bool) {
+	switch p.Kind {
+	case DeletePost:
+		r.deleted[p.Target] = true
+		return p, false
+	case EditPost:
+		//newest edit wins and we see newest first.
+		if _, found := r.edits[p.Target]; !found {
+			r.edits[p.Target] = p
+		}
+		return p, false
+	case MergePost:
+		return p, false
+	}
+	if r.deleted[p.CID] {
+		return p, false
+	}
+	if edit, found := r.edits[p.CID]; found {
+		p.Content = edit.Content
+		p.Images = edit.Images
+		p.Attachments = edit.Attachments
+		p.Tags = edit.Tags
+		p.Mentions = edit.Mentions
+		p.Preview = edit.Preview
+		edited := edit.Created
+		p.Edited = &edited
+		//what you see is the edit so that's the signature that matters.
+		p.Signed = edit.Signed
+	}
+	return p, true
+}
+
+//how many chain entries we're willing to walk per post we return so a pile of tombstones doesn't hide everything.
+const revisionSlack = 4
+
+//walkPosts follows Previous back from owners head applying edits and deletes along the way and checking signatures and sanity.
+//A MergePost brings in a second branch and we always take the newest head so edits still come before what they edit.
+//get is how the backend reads a post and ondelete gets every post we hide because it was deleted.
+func walkPosts(owner User, count int, get func(cid string) (Post, error), ondelete func(FetchedPost)) <-chan FetchedPost {
+	var posts = make(chan FetchedPost) //could buffer count buut current consumers pull these off prety fast.
+	go func() {
+		defer close(posts)
+		revs := newRevisions()
+		validator := newChainValidator(owner)
+		heads := []FetchedPost{}
+		seen := map[string]bool{} //branches share history after a merge.
+		push := func(cid string) {
+			if cid == "" || seen[cid] {
+				return
+			}
+			seen[cid] = true
+			post, err := get(cid)
+			if err != nil {
+				fallback := fmt.Sprintf("Error can't resolve content %s: %s", cid, err)
+				log.Print(fallback)
+				posts <- FetchedPost{Post: Post{Content: fallback}, CID: cid}
+				return
+			}
+			heads = append(heads, FetchedPost{Post: post, CID: cid})
+		}
+		push(owner.LastPost)
+		for walked, shown := 0, 0; len(heads) > 0 && shown < count && walked < count*revisionSlack; walked++ {
+			newest := 0
+			for i := range heads {
+				if heads[i].Created.After(heads[newest].Created) {
+					newest = i
+				}
+			}
+			post := heads[newest].Post
+			cid := heads[newest].CID
+			heads = append(heads[:newest], heads[newest+1:]...)
+
+			fp, show := revs.apply(FetchedPost{
+				Post:       post,
+				CID:        cid,
+				Signed:     post.SignatureStatusFor(owner),
+				Violations: validator.check(post),
+			})
+			if show {
+				posts <- fp
+				shown++
+			} else if !post.IsTombstone() && ondelete != nil {
+				ondelete(fp)
+			}
+			if shown < count {
+				push(post.Previous)
+				if post.Kind == MergePost {
+					push(post.Target)
+				}
+			}
+		}
+	}()
+	return posts
+}
+
+//Revised is the post at cid the way owner last left it, looking back at most depth posts from their head.
+//A deleted post comes back with Deleted set and nothing of what it said. found is false if it isn't that far back in their chain.
+func Revised(ctx context.Context, backend ContentBackend, owner User, cid string, depth int) (FetchedPost, bool) {
+	var revised, deleted *FetchedPost
+	get := func(c string) (Post, error) {
+		return backend.GetPost(ctx, c)
+	}
+	ondelete := func(p FetchedPost) {
+		if p.CID == cid {
+			deleted = &p
+		}
+	}
+	//drain the channel so walkPosts doesn't leak.
+	for p := range walkPosts(owner, depth, get, ondelete) {
+		if p.CID == cid {
+			p := p
+			revised = &p
+		}
+	}
+	switch {
+	case revised != nil:
+		return *revised, true
+	case deleted != nil:
+		//keep where it was in threads and the chain but not what it said or showed.
+		return FetchedPost{
+			Post:    Post{Author: deleted.Author, Created: deleted.Created, InReplyTo: deleted.InReplyTo},
+			CID:     cid,
+			Deleted: true,
+		}, true
+	}
+	return FetchedPost{}, false
+}
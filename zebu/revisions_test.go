@@ -0,0 +1,67 @@
+package zebu
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEditsAndDeletes(t *testing.T) {
+	m := newMemBackend()
+	alice := User{PublicName: "0xA11CE"}
+	start := time.Now().Add(-time.Hour)
+
+	keep := m.post(t, &alice, Post{Content: "keep", Created: start})
+	typo := m.post(t, &alice, Post{Content: "tpyo", Created: start.Add(time.Minute)})
+	oops := m.post(t, &alice, Post{Content: "oops", Created: start.Add(2 * time.Minute)})
+	m.post(t, &alice, Post{Kind: EditPost, Target: typo, Content: "typo", Created: start.Add(3 * time.Minute)})
+	m.post(t, &alice, Post{Kind: EditPost, Target: typo, Content: "typo!", Created: start.Add(4 * time.Minute)})
+	m.post(t, &alice, Post{Kind: DeletePost, Target: oops, Created: start.Add(5 * time.Minute)})
+
+	posts := []FetchedPost{}
+	for p := range m.GetPosts(context.Background(), alice, 10) {
+		posts = append(posts, p)
+	}
+	if len(posts) != 2 {
+		t.Fatalf("expected 2 posts got %d: %v", len(posts), posts)
+	}
+	if posts[0].CID != typo || posts[0].Content != "typo!" || posts[0].Edited == nil {
+		t.Fatalf("expected latest edit of typo got %v", posts[0])
+	}
+	if !posts[0].Edited.Equal(start.Add(4 * time.Minute)) {
+		t.Fatalf("wrong edit time %s", posts[0].Edited)
+	}
+	if posts[1].CID != keep || posts[1].Edited != nil {
+		t.Fatalf("expected untouched post got %v", posts[1])
+	}
+	if len(m.deleted) != 1 || m.deleted[0] != oops {
+		t.Fatalf("expected oops to be reported deleted got %v", m.deleted)
+	}
+}
+
+func TestRevised(t *testing.T) {
+	m := newMemBackend()
+	alice := User{PublicName: "0xA11CE"}
+	start := time.Now().Add(-time.Hour)
+	ctx := context.Background()
+
+	typo := m.post(t, &alice, Post{Content: "tpyo", Images: []string{"QmTypo"}, Created: start})
+	oops := m.post(t, &alice, Post{Content: "oops", Images: []string{"QmOops"}, Created: start.Add(time.Minute)})
+	keep := m.post(t, &alice, Post{Content: "keep", Created: start.Add(2 * time.Minute)})
+	m.post(t, &alice, Post{Kind: EditPost, Target: typo, Content: "typo", Created: start.Add(3 * time.Minute)})
+	m.post(t, &alice, Post{Kind: DeletePost, Target: oops, Created: start.Add(4 * time.Minute)})
+
+	if p, found := Revised(ctx, m, alice, typo, 10); !found || p.Content != "typo" || len(p.Images) != 0 || p.Edited == nil {
+		t.Fatalf("expected the edit of typo got %v, %t", p, found)
+	}
+	if p, found := Revised(ctx, m, alice, oops, 10); !found || !p.Deleted || p.Content != "" || len(p.Images) != 0 {
+		t.Fatalf("expected oops to be deleted with nothing left got %v, %t", p, found)
+	}
+	if p, found := Revised(ctx, m, alice, keep, 10); !found || p.Content != "keep" || p.Edited != nil {
+		t.Fatalf("expected keep untouched got %v, %t", p, found)
+	}
+	bob := User{PublicName: "0xB0B"}
+	if _, found := Revised(ctx, m, bob, keep, 10); found {
+		t.Fatalf("keep isn't in bob's chain")
+	}
+}
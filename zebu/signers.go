@@ -0,0 +1,192 @@
+package zebu
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	p2pcrypto "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+//PubKey prefixes for the signature schemes we know. Ethereum addresses predate this so they're just 0x.
+const (
+	EthereumPrefix = "0x"
+	Ed25519Prefix  = "ed25519:" //followed by the hex public key
+	Libp2pPrefix   = "libp2p:"  //followed by a peer id with an inlined key like an ipfs node's identity
+)
+
+//Verifier checks sig is pubkey's signature over data. Each scheme hashes data however it likes.
+type Verifier interface {
+	Verify(pubkey string, data []byte, sig string) error
+}
+
+//Signer is anything that can own a zebu account.
+type Signer interface {
+	PublicKey() string //with the scheme prefix
+	Sign(data []byte) (string, error)
+}
+
+var verifiers = map[string]Verifier{
+	EthereumPrefix: ethereumVerifier{},
+	Ed25519Prefix:  ed25519Verifier{},
+	Libp2pPrefix:   libp2pVerifier{},
+}
+
+func verifierFor(pubkey string) (Verifier, error) {
+	for prefix, v := range verifiers {
+		if strings.HasPrefix(pubkey, prefix) {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("no signature scheme for %s", pubkey)
+}
+
+//IsPublicKey is true for ids that are already keys and don't need resolving.
+func IsPublicKey(id string) bool {
+	_, err := verifierFor(id)
+	return err == nil
+}
+
+//verify checks sig with whatever scheme pubkey's prefix says.
+func verify(pubkey string, data []byte, sig string) error {
+	v, err := verifierFor(pubkey)
+	if err != nil {
+		return err
+	}
+	return v.Verify(pubkey, data, sig)
+}
+
+type ethereumVerifier struct{}
+
+func (ethereumVerifier) Verify(pubkey string, data []byte, sig string) error {
+	addr, err := recoverAddress(data, sig)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(addr, pubkey) {
+		return fmt.Errorf("signed by %s not %s", addr, pubkey)
+	}
+	return nil
+}
+
+//EthereumSigner personal_signs like metamask would.
+type EthereumSigner struct {
+	Key *ecdsa.PrivateKey
+}
+
+func (s EthereumSigner) PublicKey() string {
+	return crypto.PubkeyToAddress(s.Key.PublicKey).Hex()
+}
+
+func (s EthereumSigner) Sign(data []byte) (string, error) {
+	return signText(data, s.Key)
+}
+
+type ed25519Verifier struct{}
+
+func (ed25519Verifier) Verify(pubkey string, data []byte, sig string) error {
+	keybytes, err := hex.DecodeString(strings.TrimPrefix(pubkey, Ed25519Prefix))
+	if err != nil || len(keybytes) != ed25519.PublicKeySize {
+		return fmt.Errorf("bad ed25519 key %s", pubkey)
+	}
+	sigbytes, err := hex.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("sig wasn't hex %w", err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(keybytes), data, sigbytes) {
+		return fmt.Errorf("bad ed25519 signature for %s", pubkey)
+	}
+	return nil
+}
+
+//Ed25519Signer is for people without a wallet. The browser can make one of these with webcrypto.
+type Ed25519Signer struct {
+	Key ed25519.PrivateKey
+}
+
+//NewEd25519Signer takes a hex 32 byte seed, what a key file for -keytype ed25519 holds.
+func NewEd25519Signer(hexseed string) (Ed25519Signer, error) {
+	seed, err := hex.DecodeString(strings.TrimSpace(hexseed))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return Ed25519Signer{}, fmt.Errorf("ed25519 key should be a hex %d byte seed", ed25519.SeedSize)
+	}
+	return Ed25519Signer{Key: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+func (s Ed25519Signer) PublicKey() string {
+	return Ed25519Prefix + hex.EncodeToString(s.Key.Public().(ed25519.PublicKey))
+}
+
+func (s Ed25519Signer) Sign(data []byte) (string, error) {
+	return hex.EncodeToString(ed25519.Sign(s.Key, data)), nil
+}
+
+type libp2pVerifier struct{}
+
+func (libp2pVerifier) Verify(pubkey string, data []byte, sig string) error {
+	id, err := peer.Decode(strings.TrimPrefix(pubkey, Libp2pPrefix))
+	if err != nil {
+		return fmt.Errorf("bad peer id %s, %w", pubkey, err)
+	}
+	//only works for peer ids small enough to inline their key. ed25519 ones do.
+	key, err := id.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("can't get key from %s, %w", pubkey, err)
+	}
+	sigbytes, err := hex.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("sig wasn't hex %w", err)
+	}
+	ok, err := key.Verify(data, sigbytes)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("bad libp2p signature for %s", pubkey)
+	}
+	return nil
+}
+
+//Libp2pSigner lets a peer identity like the ipfs node's own own an account.
+//Make one with NewLibp2pSigner or NewLibp2pKeySigner so the peer id is worked out up front.
+type Libp2pSigner struct {
+	key p2pcrypto.PrivKey
+	id  peer.ID
+}
+
+//NewLibp2pSigner takes the base64 Identity.PrivKey out of an ipfs config.
+func NewLibp2pSigner(configkey string) (Libp2pSigner, error) {
+	keybytes, err := p2pcrypto.ConfigDecodeKey(strings.TrimSpace(configkey))
+	if err != nil {
+		return Libp2pSigner{}, err
+	}
+	key, err := p2pcrypto.UnmarshalPrivateKey(keybytes)
+	if err != nil {
+		return Libp2pSigner{}, err
+	}
+	return NewLibp2pKeySigner(key)
+}
+
+func NewLibp2pKeySigner(key p2pcrypto.PrivKey) (Libp2pSigner, error) {
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return Libp2pSigner{}, fmt.Errorf("no peer id for key, %w", err)
+	}
+	return Libp2pSigner{key: key, id: id}, nil
+}
+
+func (s Libp2pSigner) PublicKey() string {
+	return Libp2pPrefix + s.id.String()
+}
+
+func (s Libp2pSigner) Sign(data []byte) (string, error) {
+	sig, err := s.key.Sign(data)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sig), nil
+}
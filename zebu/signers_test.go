@@ -0,0 +1,141 @@
+package zebu
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	p2pcrypto "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+func testSigners(t *testing.T) []Signer {
+	t.Helper()
+	eth, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2p, _, err := p2pcrypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2psigner, err := NewLibp2pKeySigner(p2p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []Signer{EthereumSigner{Key: eth}, Ed25519Signer{Key: ed}, p2psigner}
+}
+
+func TestSignerRecords(t *testing.T) {
+	signers := testSigners(t)
+	for i, s := range signers {
+		if !IsPublicKey(s.PublicKey()) {
+			t.Fatalf("%s should be a public key", s.PublicKey())
+		}
+		unr := UserNameRecord{CID: "Qmd8fBSQeJ2MNkALQiLCFihymSAM4o7i13VnEJSAofAZWb", Sequence: 3, PubKey: s.PublicKey()}
+		if err := unr.SignWith(s); err != nil {
+			t.Fatal(err)
+		}
+		if !unr.Validate() {
+			t.Fatalf("%s record didn't validate", s.PublicKey())
+		}
+
+		//someone else's key claiming the same signature
+		other := signers[(i+1)%len(signers)]
+		stolen := unr
+		stolen.PubKey = other.PublicKey()
+		if stolen.Validate() {
+			t.Fatalf("%s validated %s's signature", other.PublicKey(), s.PublicKey())
+		}
+
+		unr.Sequence++
+		if unr.Validate() {
+			t.Fatalf("%s validated a tampered record", s.PublicKey())
+		}
+	}
+}
+
+func TestSignerPosts(t *testing.T) {
+	for _, s := range testSigners(t) {
+		p := Post{Content: "hello from " + s.PublicKey()}
+		if err := p.SignWith(s); err != nil {
+			t.Fatal(err)
+		}
+		if status := p.SignatureStatus(s.PublicKey()); status != SignatureValid {
+			t.Fatalf("%s post was %s", s.PublicKey(), status)
+		}
+		p.Content = "edited"
+		if status := p.SignatureStatus(s.PublicKey()); status != SignatureMismatch {
+			t.Fatalf("%s tampered post was %s", s.PublicKey(), status)
+		}
+	}
+}
+
+func TestEthereumSignerMatchesLegacy(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := EthereumSigner{Key: key}
+	a := UserNameRecord{CID: "Qmd8fBSQeJ2MNkALQiLCFihymSAM4o7i13VnEJSAofAZWb", Sequence: 1, PubKey: s.PublicKey()}
+	b := a
+	if err := a.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SignWith(s); err != nil {
+		t.Fatal(err)
+	}
+	if a.Signature != b.Signature {
+		t.Fatalf("personal_sign and SignWith disagree %s %s", a.Signature, b.Signature)
+	}
+}
+
+func TestSignerKeyFiles(t *testing.T) {
+	p2p, _, err := p2pcrypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keybytes, err := p2pcrypto.MarshalPrivateKey(p2p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromconfig, err := NewLibp2pSigner(p2pcrypto.ConfigEncodeKey(keybytes) + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromkey, err := NewLibp2pKeySigner(p2p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromconfig.PublicKey() != fromkey.PublicKey() || !strings.HasPrefix(fromkey.PublicKey(), Libp2pPrefix+"12D3") {
+		t.Fatalf("config key %s and key %s should be the same peer", fromconfig.PublicKey(), fromkey.PublicKey())
+	}
+
+	seed := strings.Repeat("ab", ed25519.SeedSize)
+	ed, err := NewEd25519Signer(seed + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Ed25519Signer{Key: ed25519.NewKeyFromSeed(common.FromHex(seed))}).PublicKey(); ed.PublicKey() != want {
+		t.Fatalf("expected %s got %s", want, ed.PublicKey())
+	}
+	if _, err := NewEd25519Signer("abab"); err == nil {
+		t.Fatalf("short seeds shouldn't make a signer")
+	}
+}
+
+func TestUnknownScheme(t *testing.T) {
+	if IsPublicKey("alice.eth") {
+		t.Fatalf("ens names aren't keys")
+	}
+	unr := UserNameRecord{CID: "Qmd8fBSQeJ2MNkALQiLCFihymSAM4o7i13VnEJSAofAZWb", Sequence: 1, PubKey: "rsa:abc", Signature: "00"}
+	if unr.Validate() {
+		t.Fatalf("validated unknown scheme")
+	}
+}
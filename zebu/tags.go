@@ -0,0 +1,42 @@
+package zebu
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	//tags have to start with a letter so "#1" stays a number. The character before the # can't be
+	//part of a word, a url or an html entity (&#39;) which go's regexp has no lookbehind for so it's in the match.
+	hashtag = regexp.MustCompile(`(^|[^\p{L}\p{N}_&#/])#(\p{L}[\p{L}\p{N}_]*)`)
+	bareURL = regexp.MustCompile(`https?://\S+`)
+)
+
+const (
+	maxTags      = 10
+	maxTagLength = 64
+)
+
+//NormalizeTag is how tags are compared and indexed. #Zebu and #zebu are the same tag.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
+
+//ExtractTags finds the hashtags in post content, normalized and without duplicates.
+//Code and urls don't count so a #define or a link to a #section isn't a topic.
+func ExtractTags(content string) []string {
+	content = markdownCode.ReplaceAllString(content, " ")
+	content = bareURL.ReplaceAllString(content, " ")
+	tags := []string{}
+	for _, m := range hashtag.FindAllStringSubmatch(content, -1) {
+		tag := NormalizeTag(m[2])
+		if len(tag) > maxTagLength || contains(tags, tag) {
+			continue
+		}
+		tags = append(tags, tag)
+		if len(tags) == maxTags {
+			break
+		}
+	}
+	return tags
+}
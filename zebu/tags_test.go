@@ -0,0 +1,22 @@
+package zebu
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractTags(t *testing.T) {
+	cases := map[string][]string{
+		"#zebu is #Fun, #zebu again":                   {"zebu", "fun"},
+		"no tags here #1 isn't one either":             {},
+		"email me@x.com#nope or see https://x/#anchor": {},
+		"page#section and &#39; entities":              {},
+		"`#define` and ```\n#include\n```  #real":      {"real"},
+		"(#parens) #ünïcode #with_underscore":          {"parens", "ünïcode", "with_underscore"},
+	}
+	for content, want := range cases {
+		if got := ExtractTags(content); !reflect.DeepEqual(got, want) {
+			t.Errorf("ExtractTags(%q) = %v want %v", content, got, want)
+		}
+	}
+}
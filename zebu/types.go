@@ -19,77 +19,171 @@ import (
 //https://github.com/ipfs/specs/blob/main/ipns/IPNS.md#record-serialization-format"
 //go validation would be good here.
 type UserNameRecord struct {
-	CID       string
-	Sequence  uint64
-	Signature string `json:"Signature,omitempty"`
-	PubKey    string //should we use bytes?
+	CID        string
+	Sequence   uint64
+	Signature  string      `json:"Signature,omitempty"`
+	PubKey     string      //should we use bytes?
+	Scheme     string      `json:"Scheme,omitempty"`     //LegacyScheme, EIP712Scheme or EIP712ChainScheme
+	Delegation *Delegation `json:"Delegation,omitempty"` //set when a delegate signed instead of PubKey. Not part of what's signed.
+	Previous   string      `json:"Previous,omitempty"`   //CID of the record this one replaces so nodes can spot forks
+	Merged     string      `json:"Merged,omitempty"`     //CID of a forked record this one merges back in
 }
 
-func (unr UserNameRecord) Validate() bool {
+//what gets signed under the legacy scheme. Ethereum keys personal_sign it, other keys sign it raw.
+func (unr UserNameRecord) signingData() ([]byte, error) {
 	clone := unr
 	clone.Signature = ""
-
+	clone.Delegation = nil //so a session key can sign exactly what the server handed it.
+	//{"CID":"Qmf7u5D4xAiAALdBTaFhsmU29PycWgZrZStV4Sv83n4icQ","Sequence":1,"PubKey":"0xCbd6073f486714E6641bf87c22A9CEc25aCf5804"}
+	//{"CID":"QmYpdmbS3m677XLjixE6YkeMxCcnAvxmksWiubK4pigiFw","Sequence":1,"PubKey":"0xCbd6073f486714E6641bf87c22A9CEc25aCf5804"}
 	data, err := json.Marshal(clone)
 	if err != nil {
-		log.Printf("couldn't marshal unr %s", err)
+		return nil, fmt.Errorf("couldn't marshal unr %w", err)
+	}
+	return data, nil
+}
+
+//the hash that gets signed under the records scheme. Only makes sense for ethereum keys.
+func (unr UserNameRecord) signingHash() ([]byte, error) {
+	switch unr.Scheme {
+	case LegacyScheme:
+		data, err := unr.signingData()
+		if err != nil {
+			return nil, err
+		}
+		return accounts.TextHash(data), nil
+	case EIP712Scheme, EIP712ChainScheme:
+		return typedDataHash(unr.TypedData())
+	}
+	return nil, fmt.Errorf("unknown signing scheme %s", unr.Scheme)
+}
+
+//signer is whoever should have signed the record, the owner or their delegate.
+func (unr UserNameRecord) signer() (string, error) {
+	if unr.Delegation == nil {
+		return unr.PubKey, nil
+	}
+	if err := unr.Delegation.Check(unr.PubKey, time.Now()); err != nil {
+		return "", fmt.Errorf("bad delegation %w", err)
+	}
+	return unr.Delegation.Delegate, nil
+}
+
+func (unr UserNameRecord) verify() error {
+	//only eip712-v2 signs these. Under the older schemes they'd be unsigned or change the json legacy clients sign.
+	if unr.Scheme != EIP712ChainScheme && (unr.Previous != "" || unr.Merged != "") {
+		return fmt.Errorf("Previous and Merged need the %s scheme", EIP712ChainScheme)
+	}
+	signer, err := unr.signer()
+	if err != nil {
+		return err
+	}
+	switch unr.Scheme {
+	case LegacyScheme:
+		data, err := unr.signingData()
+		if err != nil {
+			return err
+		}
+		return verify(signer, data, unr.Signature)
+	case EIP712Scheme, EIP712ChainScheme:
+		//typed data is a wallet thing so only ethereum keys can use it.
+		hash, err := unr.signingHash()
+		if err != nil {
+			return err
+		}
+		addr, err := recoverHash(hash, unr.Signature)
+		if err != nil {
+			return err
+		}
+		if addr != signer {
+			return fmt.Errorf("signed by %s not %s", addr, signer)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown signing scheme %s", unr.Scheme)
+}
+
+func (unr UserNameRecord) Validate() bool {
+	if err := unr.verify(); err != nil {
+		log.Printf("couldn't validate %s: %s", unr.PubKey, err)
 		return false
 	}
+	return true
+}
 
-	//{"CID":"Qmf7u5D4xAiAALdBTaFhsmU29PycWgZrZStV4Sv83n4icQ","Sequence":1,"PubKey":"0xCbd6073f486714E6641bf87c22A9CEc25aCf5804"}
-	//{"CID":"QmYpdmbS3m677XLjixE6YkeMxCcnAvxmksWiubK4pigiFw","Sequence":1,"PubKey":"0xCbd6073f486714E6641bf87c22A9CEc25aCf5804"}
-	//https://github.com/ethereum/go-ethereum/blob/b628d7276624c2d8ea7dd97d2259a2c2fce7d3cc/accounts/accounts.go#L197
+//Sign with whatever Scheme is set to.
+func (unr *UserNameRecord) Sign(privatekey *ecdsa.PrivateKey) error {
+	unr.Signature = ""
+	hash, err := unr.signingHash()
+	if err != nil {
+		return fmt.Errorf("could not sign %v, %w", unr, err)
+	}
+	unr.Signature, err = signHash(hash, privatekey)
+	return err
+}
 
-	//https://ethereum.stackexchange.com/questions/45580/validating-go-ethereum-key-signature-with-ecrecover
-	//https://github.com/storyicon/sigverify
-	//https://github.com/ethereum/go-ethereum/blob/1c737e8b6da2b14111f8224ef3f385b1fe0cd8b9/crypto/signature_cgo.go#L32
+//SignWith signs under the legacy scheme with any kind of key.
+func (unr *UserNameRecord) SignWith(s Signer) error {
+	if unr.Scheme != LegacyScheme {
+		return fmt.Errorf("%s records can only be signed with ethereum keys", unr.Scheme)
+	}
+	unr.Signature = ""
+	data, err := unr.signingData()
+	if err != nil {
+		return err
+	}
+	unr.Signature, err = s.Sign(data)
+	return err
+}
+
+//recovers the address that personal_signed data.
+func recoverAddress(data []byte, sig string) (string, error) {
+	return recoverHash(accounts.TextHash(data), sig)
+}
 
-	sig := unr.Signature
+//https://github.com/ethereum/go-ethereum/blob/b628d7276624c2d8ea7dd97d2259a2c2fce7d3cc/accounts/accounts.go#L197
+//https://ethereum.stackexchange.com/questions/45580/validating-go-ethereum-key-signature-with-ecrecover
+//https://github.com/storyicon/sigverify
+//https://github.com/ethereum/go-ethereum/blob/1c737e8b6da2b14111f8224ef3f385b1fe0cd8b9/crypto/signature_cgo.go#L32
+func recoverHash(hash []byte, sig string) (string, error) {
 	//why doesn't hex.DecodeString do this for me?
-	if strings.HasPrefix(sig, "0x") {
-		sig = unr.Signature[2:]
-	}
+	sig = strings.TrimPrefix(sig, "0x")
 
 	sigbytes, err := hex.DecodeString(sig)
 	if err != nil {
-		log.Printf("sig wasn't hex %s", err)
-		return false
+		return "", fmt.Errorf("sig wasn't hex %w", err)
+	}
+	if len(sigbytes) != 65 {
+		return "", fmt.Errorf("sig was %d bytes not 65", len(sigbytes))
 	}
 
 	//this magic is in sigverify and signer/core/signed_data.go in go-ethereeum.
 	if sigbytes[64] != 27 && sigbytes[64] != 28 {
-		log.Printf("invalid Ethereum signature (V is not 27 or 28)")
-		return false
+		return "", fmt.Errorf("invalid Ethereum signature (V is not 27 or 28)")
 	}
 	sigbytes[64] -= 27 // Transform yellow paper V from 27/28 to 0/1
 
-	pubkey, err := crypto.SigToPub(accounts.TextHash(data), sigbytes)
-
-	//pubkey, err := crypto.Ecrecover(accounts.TextHash(data), sigbytes)
+	pubkey, err := crypto.SigToPub(hash, sigbytes)
 	if err != nil {
-		log.Printf("got error recovering addr %s", err)
-		return false
+		return "", fmt.Errorf("got error recovering addr %w", err)
 	}
-	addr := crypto.PubkeyToAddress(*pubkey)
-	//log.Printf("recovered %s known addr %s", addr.Hex(), unr.PubKey)
-	return addr.Hex() == unr.PubKey
-
+	return crypto.PubkeyToAddress(*pubkey).Hex(), nil
 }
 
-func (unr *UserNameRecord) Sign(privatekey *ecdsa.PrivateKey) error {
-	junr, err := json.Marshal(unr)
-	if err != nil {
-		return fmt.Errorf("could not marshal %v, %w", unr, err)
-	}
+//personal_sign the way metamask does so either can verify the other.
+func signText(data []byte, privatekey *ecdsa.PrivateKey) (string, error) {
+	return signHash(accounts.TextHash(data), privatekey)
+}
 
-	sig, err := crypto.Sign(accounts.TextHash(junr), privatekey)
+func signHash(hash []byte, privatekey *ecdsa.PrivateKey) (string, error) {
+	sig, err := crypto.Sign(hash, privatekey)
 	if err != nil {
-		return fmt.Errorf("could not sign  %s, %w", junr, err)
+		return "", fmt.Errorf("could not sign  %x, %w", hash, err)
 	}
 
 	//magic see github.com/ethereum/go-ethereum@v1.10.20/signer/core/signed_data.go
 	sig[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
-	unr.Signature = hex.EncodeToString(sig)
-	return nil
+	return hex.EncodeToString(sig), nil
 }
 
 //todo better names for display and public names that deosn't break back compat
@@ -100,6 +194,15 @@ type User struct {
 	DisplayName  string   //ens or dns name
 	PublicName   string   //public key
 	ImportSource string   `json:"ImportSource,omitempty"`
+	Muted        []string `json:"Muted,omitempty"`   //names or keys whose posts we don't want to see
+	Blocked      []string `json:"Blocked,omitempty"` //muted plus we don't want to see others reposting or replying to them
+	//session keys that can't sign for us anymore even if their delegation hasn't expired.
+	RevokedDelegates []string `json:"RevokedDelegates,omitempty"`
+	//profile
+	Avatar     string   `json:"Avatar,omitempty"` //image CID
+	Bio        string   `json:"Bio,omitempty"`
+	Links      []string `json:"Links,omitempty"`
+	PinnedPost string   `json:"PinnedPost,omitempty"` //CID of one of our own posts to show first
 }
 
 type LikeChunk struct {
@@ -120,28 +223,214 @@ func (u *User) PublicKey() string {
 
 //ugh why doesn't this exist.
 func (u *User) Follow(user string) {
-	for _, f := range u.Follows {
-		if f == user {
-			return
+	u.Follows = addName(u.Follows, user)
+}
+
+func (u *User) Unfollow(user string) {
+	u.Follows = removeName(u.Follows, user)
+}
+
+func (u *User) Mute(user string) {
+	u.Muted = addName(u.Muted, user)
+}
+
+func (u *User) Unmute(user string) {
+	u.Muted = removeName(u.Muted, user)
+}
+
+//blocking someone also stops following them.
+func (u *User) Block(user string) {
+	u.Blocked = addName(u.Blocked, user)
+	u.Unfollow(user)
+}
+
+func (u *User) Unblock(user string) {
+	u.Blocked = removeName(u.Blocked, user)
+}
+
+//RevokeDelegate stops a session key signing for us. Only the main key can publish this.
+func (u *User) RevokeDelegate(delegate string) {
+	u.RevokedDelegates = addName(u.RevokedDelegates, delegate)
+}
+
+//Hides is true if any of the names (display name, key etc) are muted or blocked.
+func (u *User) Hides(names ...string) bool {
+	return u.IsBlocked(names...) || hasName(u.Muted, names...)
+}
+
+func (u *User) IsBlocked(names ...string) bool {
+	return hasName(u.Blocked, names...)
+}
+
+func hasName(list []string, names ...string) bool {
+	for _, l := range list {
+		for _, n := range names {
+			if n != "" && strings.EqualFold(l, n) {
+				return true
+			}
 		}
 	}
-	u.Follows = append(u.Follows, user)
+	return false
+}
+
+func addName(list []string, name string) []string {
+	if hasName(list, name) {
+		return list
+	}
+	return append(list, name)
+}
+
+func removeName(list []string, name string) []string {
+	kept := []string{}
+	for _, l := range list {
+		if !strings.EqualFold(l, name) {
+			kept = append(kept, l)
+		}
+	}
+	return kept
 }
 
 //previous, contentm and images are all CIDS but we don't recurse automatically using ipfs because we don't want pin all history.
 type Post struct {
-	Previous string
-	Content  string
-	Images   []string  //this makes it hard to do images inline? don't care?
-	Created  time.Time //can't actually trust this
-	Author   string    //publicname?
+	Previous    string
+	Content     string
+	Images      []string     //just the CIDs of Attachments so older readers still show something.
+	Attachments []Attachment `json:"Attachments,omitempty"`
+	Tags        []string     `json:"Tags,omitempty"`     //hashtags in Content so clients don't have to parse it. Older posts don't have them and the index reads Content anyway.
+	Mentions    []string     `json:"Mentions,omitempty"` //keys of the accounts @mentioned in Content, resolved when it was posted.
+	Preview     string       `json:"Preview,omitempty"`  //cid of a LinkPreview of the first link in Content
+	Created     time.Time    //can't actually trust this
+	Author      string       //publicname?
+	RepostOf    *PostRef     `json:"RepostOf,omitempty"` //content and images are copied so old readers still show something.
+	InReplyTo   *PostRef     `json:"InReplyTo,omitempty"`
+	Kind        string       `json:"Kind,omitempty"`       //empty for a normal post otherwise EditPost, DeletePost or MergePost
+	Target      string       `json:"Target,omitempty"`     //cid of the post an edit or delete applies to
+	Delegation  *Delegation  `json:"Delegation,omitempty"` //set when a session key signed instead of the author's own
+	Signature   string       `json:"Signature,omitempty"`  //authors personal_sign of the post without the signature
+}
+
+//Attachment is a file on a post. For images Medium and Thumbnail are smaller copies for post pages and feeds.
+type Attachment struct {
+	CID       string
+	Type      string //mime type
+	Width     int    `json:"Width,omitempty"`
+	Height    int    `json:"Height,omitempty"`
+	Size      int64  `json:"Size,omitempty"` //bytes
+	Alt       string `json:"Alt,omitempty"`  //what a screen reader says instead
+	Blurhash  string `json:"Blurhash,omitempty"`
+	Medium    string `json:"Medium,omitempty"`
+	Thumbnail string `json:"Thumbnail,omitempty"`
+}
+
+//Kind is image, video, audio or file. Legacy Images don't have a type but were always images.
+func (a Attachment) Kind() string {
+	if a.Type == "" {
+		return "image"
+	}
+	for _, kind := range []string{"image", "video", "audio"} {
+		if strings.HasPrefix(a.Type, kind+"/") {
+			return kind
+		}
+	}
+	return "file"
+}
+
+//Media is the post's attachments or ones made up from legacy Images. Missing copies fall back to the original.
+func (p Post) Media() []Attachment {
+	media := p.Attachments
+	if len(media) == 0 {
+		for _, cid := range p.Images {
+			media = append(media, Attachment{CID: cid})
+		}
+	}
+	filled := make([]Attachment, 0, len(media))
+	for _, a := range media {
+		if a.Medium == "" {
+			a.Medium = a.CID
+		}
+		if a.Thumbnail == "" {
+			a.Thumbnail = a.Medium
+		}
+		filled = append(filled, a)
+	}
+	return filled
+}
+
+const (
+	SignatureValid    = "valid"
+	SignatureMissing  = "unsigned"
+	SignatureMismatch = "mismatch"
+)
+
+func (p Post) canonical() ([]byte, error) {
+	clone := p
+	clone.Signature = ""
+	return json.Marshal(clone)
+}
+
+func (p *Post) Sign(privatekey *ecdsa.PrivateKey) error {
+	return p.SignWith(EthereumSigner{Key: privatekey})
+}
+
+func (p *Post) SignWith(s Signer) error {
+	data, err := p.canonical()
+	if err != nil {
+		return fmt.Errorf("could not marshal %v, %w", p, err)
+	}
+	p.Signature, err = s.Sign(data)
+	return err
+}
+
+//SignatureStatus checks the post was signed by pubkey. Lets you trust a post no matter whose chain it showed up in.
+func (p Post) SignatureStatus(pubkey string) string {
+	if p.Signature == "" {
+		return SignatureMissing
+	}
+	data, err := p.canonical()
+	if err != nil {
+		return SignatureMismatch
+	}
+	if err := verify(pubkey, data, p.Signature); err != nil {
+		return SignatureMismatch
+	}
+	return SignatureValid
+}
+
+//SignatureStatusFor is SignatureStatus against owner, or against a delegate owner let sign posts and hasn't revoked.
+func (p Post) SignatureStatusFor(owner User) string {
+	if p.Delegation == nil {
+		return p.SignatureStatus(owner.PublicKey())
+	}
+	d := *p.Delegation
+	//reading old posts can only go by when they say they were made. New ones are held to the real time when they're published.
+	if d.Check(owner.PublicKey(), p.Created) != nil || !d.allows(ScopePosts) || hasName(owner.RevokedDelegates, d.Delegate) {
+		return SignatureMismatch
+	}
+	return p.SignatureStatus(d.Delegate)
+}
+
+//points at a post in someone elses chain. Author is a public key so we don't have to trust the post to find them.
+type PostRef struct {
+	CID    string
+	Author string
 }
 
 //this is never meant to be a backend  contract and just a ui helper.
 type FetchedPost struct {
 	Post
+	CID             string
 	RenderedContent template.HTML
-	Author          string //this can be a lie if I repost someone elses thing.
+	Author          string       //this can be a lie if I repost someone elses thing.
+	RepostedBy      string       `json:"RepostedBy,omitempty"`
+	Edited          *time.Time   `json:"Edited,omitempty"`  //when the content came from a later edit
+	Deleted         bool         `json:"Deleted,omitempty"` //its author deleted it, there's nothing else to show
+	Signed          string       //SignatureValid, SignatureMissing or SignatureMismatch against the author we think it has
+	Violations      []string     `json:"Violations,omitempty"` //what the chain validator didn't like about this post
+	Unverified      bool         `json:"Unverified,omitempty"` //RepostOf isn't in its author's chain so this is left as the reposter's copy
+	AuthorAvatar    string       `json:"AuthorAvatar,omitempty"`
+	AuthorBio       string       `json:"AuthorBio,omitempty"`
+	LinkPreview     *LinkPreview `json:"LinkPreview,omitempty"`   //Preview read back for rendering
+	AuthorEnsName   string       `json:"AuthorEnsName,omitempty"` //primary ens name of an author who's only an address
 }
 
 func (fp FetchedPost) PrettyCreated() string {
@@ -0,0 +1,38 @@
+package zebu
+
+import "testing"
+
+func TestFollowLists(t *testing.T) {
+	var u User
+	u.Follow("johnwilkes.northbriton.net")
+	u.Follow("johnwilkes.northbriton.net")
+	u.Follow("0xB0B")
+	if len(u.Follows) != 2 {
+		t.Fatalf("follow should be idempotent %v", u.Follows)
+	}
+	u.Unfollow("JohnWilkes.northbriton.net")
+	if len(u.Follows) != 1 || u.Follows[0] != "0xB0B" {
+		t.Fatalf("unfollow didn't remove %v", u.Follows)
+	}
+
+	u.Mute("spammer.eth")
+	if !u.Hides("someone", "spammer.eth") || u.IsBlocked("spammer.eth") {
+		t.Fatalf("mute should hide but not block")
+	}
+	u.Unmute("spammer.eth")
+	if u.Hides("spammer.eth") {
+		t.Fatalf("unmute didn't")
+	}
+
+	u.Block("0xb0b")
+	if !u.IsBlocked("0xB0B") || !u.Hides("0xB0B") {
+		t.Fatalf("block should hide and block")
+	}
+	if len(u.Follows) != 0 {
+		t.Fatalf("block should unfollow %v", u.Follows)
+	}
+	u.Unblock("0xB0B")
+	if u.Hides("0xB0B") || u.Hides("") {
+		t.Fatalf("unblock didn't")
+	}
+}
@@ -0,0 +1,258 @@
+package zebu
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	//MaxUploadSize is the most one upload can be. Big enough for a phone video.
+	MaxUploadSize = 1 << 30
+	//DailyUploadQuota is how much an account can start uploading in a day.
+	DailyUploadQuota = 4 << 30
+	//an upload nobody has written to for this long is abandoned.
+	uploadIdle = time.Hour
+	//how long a finished upload can wait to be attached to a post.
+	uploadKeep = 24 * time.Hour
+)
+
+var (
+	ErrUploadNotFound = errors.New("no such upload")
+	ErrUploadBusy     = errors.New("upload is already being written")
+	ErrOffsetMismatch = errors.New("offset doesn't match what we have")
+	ErrUploadTooBig   = fmt.Errorf("uploads can't be more than %d bytes", MaxUploadSize)
+	ErrQuotaExceeded  = errors.New("upload quota exceeded")
+)
+
+//Upload is where a resumable upload has got to. Once Offset reaches Length it gets a CID.
+type Upload struct {
+	ID      string
+	Account string
+	Length  int64
+	Offset  int64
+	CID     string `json:"CID,omitempty"`
+	Err     string `json:"Err,omitempty"` //ipfs didn't like it
+	Touched time.Time
+}
+
+type upload struct {
+	Upload
+	writing sync.Mutex //one write at a time, resumes wait for the broken one to notice
+	pw      *io.PipeWriter
+	done    chan struct{} //closed when Add returns
+	cancel  context.CancelFunc
+}
+
+type quotaUse struct {
+	at    time.Time
+	bytes int64
+}
+
+//Uploads streams resumable uploads into ipfs as the chunks arrive so nothing big sits in memory or on disk.
+//Each upload is one Add reading from a pipe that chunks get written into. State is only in memory,
+//a restart loses uploads in flight and clients start again.
+type Uploads struct {
+	backend ContentBackend
+	quota   int64
+	lock    sync.Mutex
+	uploads map[string]*upload
+	usage   map[string][]quotaUse
+}
+
+func NewUploads(backend ContentBackend, quota int64) *Uploads {
+	return &Uploads{
+		backend: backend,
+		quota:   quota,
+		uploads: map[string]*upload{},
+		usage:   map[string][]quotaUse{},
+	}
+}
+
+//Create starts an upload of length bytes for account. It counts against their quota even if they never finish.
+func (u *Uploads) Create(account string, length int64) (Upload, error) {
+	if length <= 0 {
+		return Upload{}, fmt.Errorf("bad upload length %d", length)
+	}
+	if length > MaxUploadSize {
+		return Upload{}, ErrUploadTooBig
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Upload{}, err
+	}
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	now := time.Now()
+	used := int64(0)
+	recent := []quotaUse{}
+	for _, q := range u.usage[account] {
+		if now.Sub(q.at) < 24*time.Hour {
+			used += q.bytes
+			recent = append(recent, q)
+		}
+	}
+	if used+length > u.quota {
+		return Upload{}, fmt.Errorf("%w, %s has %d of %d bytes left today", ErrQuotaExceeded, account, u.quota-used, u.quota)
+	}
+	u.usage[account] = append(recent, quotaUse{at: now, bytes: length})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, pw := io.Pipe()
+	up := &upload{
+		Upload: Upload{ID: hex.EncodeToString(id), Account: account, Length: length, Touched: now},
+		pw:     pw,
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	u.uploads[up.ID] = up
+	go func() {
+		defer close(up.done)
+		cid, err := u.backend.Add(ctx, pr)
+		//anyone still writing needs to stop.
+		pr.CloseWithError(fmt.Errorf("upload finished early, %v", err))
+		u.lock.Lock()
+		defer u.lock.Unlock()
+		if err != nil {
+			up.Err = err.Error()
+			return
+		}
+		up.CID = cid
+	}()
+	return up.Upload, nil
+}
+
+//Get is a snapshot of where an upload is.
+func (u *Uploads) Get(id string) (Upload, error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	up, found := u.uploads[id]
+	if !found {
+		return Upload{}, ErrUploadNotFound
+	}
+	return up.Upload, nil
+}
+
+//Write appends r at offset which has to be where the upload is. A write that breaks part way
+//keeps what made it so the client asks where we are and carries on from there.
+//Writing the last byte waits for ipfs and the result has the CID.
+func (u *Uploads) Write(id string, offset int64, r io.Reader) (Upload, error) {
+	u.lock.Lock()
+	up, found := u.uploads[id]
+	u.lock.Unlock()
+	if !found {
+		return Upload{}, ErrUploadNotFound
+	}
+	if !up.writing.TryLock() {
+		return Upload{}, ErrUploadBusy
+	}
+	defer up.writing.Unlock()
+
+	u.lock.Lock()
+	current, length := up.Offset, up.Length
+	u.lock.Unlock()
+	if offset != current {
+		return Upload{}, fmt.Errorf("%w, at %d not %d", ErrOffsetMismatch, current, offset)
+	}
+
+	written, err := io.Copy(&offsetWriter{w: up.pw, up: up, lock: &u.lock}, io.LimitReader(r, length-current))
+	if err == nil && current+written == length {
+		up.pw.Close()
+		<-up.done
+	}
+	snapshot, _ := u.Get(id)
+	if err == nil && snapshot.Err != "" {
+		err = errors.New(snapshot.Err)
+	}
+	return snapshot, err
+}
+
+//moves the upload's offset along as each chunk goes into the pipe.
+type offsetWriter struct {
+	w    io.Writer
+	up   *upload
+	lock *sync.Mutex
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.Write(p)
+	o.lock.Lock()
+	o.up.Offset += int64(n)
+	o.up.Touched = time.Now()
+	o.lock.Unlock()
+	return n, err
+}
+
+//Cancel stops an upload. The quota it used stays used.
+func (u *Uploads) Cancel(id string) error {
+	u.lock.Lock()
+	up, found := u.uploads[id]
+	delete(u.uploads, id)
+	u.lock.Unlock()
+	if !found {
+		return ErrUploadNotFound
+	}
+	up.cancel()
+	up.pw.CloseWithError(errors.New("upload cancelled"))
+	return nil
+}
+
+//Completed finds a finished upload of cid by account so it can go on one of their posts.
+func (u *Uploads) Completed(account, cid string) (Upload, bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	for _, up := range u.uploads {
+		if up.Account == account && up.CID == cid {
+			return up.Upload, true
+		}
+	}
+	return Upload{}, false
+}
+
+//Attached hands a finished upload over to the post it went on so expiring doesn't remove it.
+func (u *Uploads) Attached(id string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	delete(u.uploads, id)
+}
+
+//Expire drops abandoned uploads and removes finished ones nobody attached from ipfs.
+func (u *Uploads) Expire(now time.Time) {
+	u.lock.Lock()
+	expired := map[string]string{}
+	for id, up := range u.uploads {
+		idle := now.Sub(up.Touched)
+		if (up.CID == "" && idle > uploadIdle) || idle > uploadKeep {
+			expired[id] = up.CID
+		}
+	}
+	u.lock.Unlock()
+	for id, cid := range expired {
+		u.Cancel(id)
+		if cid == "" {
+			continue
+		}
+		if err := u.backend.Remove(context.Background(), cid); err != nil {
+			log.Printf("couldn't remove expired upload %s, %s", cid, err)
+		}
+	}
+}
+
+//Run expires uploads every interval until the context is cancelled.
+func (u *Uploads) Run(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+			u.Expire(time.Now())
+		}
+	}
+}
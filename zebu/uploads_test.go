@@ -0,0 +1,126 @@
+package zebu
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+//brokenReader gives up part way like a phone going into a tunnel.
+type brokenReader struct {
+	r     io.Reader
+	after int
+}
+
+func (b *brokenReader) Read(p []byte) (int, error) {
+	if b.after <= 0 {
+		return 0, errors.New("connection reset")
+	}
+	if len(p) > b.after {
+		p = p[:b.after]
+	}
+	n, err := b.r.Read(p)
+	b.after -= n
+	return n, err
+}
+
+func TestUploadResumes(t *testing.T) {
+	backend := newMemBackend()
+	uploads := NewUploads(backend, 1<<20)
+	data := bytes.Repeat([]byte("zebu"), 1000)
+
+	up, err := uploads.Create("alice", int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uploads.Write(up.ID, 0, &brokenReader{r: bytes.NewReader(data), after: 1500}); err == nil {
+		t.Fatalf("expected the broken write to fail")
+	}
+	status, err := uploads.Get(up.ID)
+	if err != nil || status.Offset != 1500 {
+		t.Fatalf("expected to be at 1500 got %d %v", status.Offset, err)
+	}
+	if _, err := uploads.Write(up.ID, 0, bytes.NewReader(data)); !errors.Is(err, ErrOffsetMismatch) {
+		t.Fatalf("expected offset mismatch got %v", err)
+	}
+	done, err := uploads.Write(up.ID, status.Offset, bytes.NewReader(data[status.Offset:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.CID == "" || done.Offset != int64(len(data)) {
+		t.Fatalf("expected a cid got %+v", done)
+	}
+	if !bytes.Equal(backend.objects[done.CID], data) {
+		t.Fatalf("stored data doesn't match")
+	}
+	if _, found := uploads.Completed("alice", done.CID); !found {
+		t.Fatalf("alice should be able to attach it")
+	}
+	if _, found := uploads.Completed("mallory", done.CID); found {
+		t.Fatalf("mallory shouldn't be able to attach it")
+	}
+}
+
+func TestUploadQuota(t *testing.T) {
+	uploads := NewUploads(newMemBackend(), 100)
+	if _, err := uploads.Create("alice", 60); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uploads.Create("alice", 60); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected quota exceeded got %v", err)
+	}
+	if _, err := uploads.Create("bob", 60); err != nil {
+		t.Fatalf("quotas are per account %v", err)
+	}
+	if _, err := uploads.Create("bob", MaxUploadSize+1); !errors.Is(err, ErrUploadTooBig) {
+		t.Fatalf("expected too big got %v", err)
+	}
+}
+
+func TestUploadExpires(t *testing.T) {
+	uploads := NewUploads(newMemBackend(), 100)
+	up, err := uploads.Create("alice", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploads.Expire(time.Now())
+	if _, err := uploads.Get(up.ID); err != nil {
+		t.Fatalf("fresh upload expired %v", err)
+	}
+	uploads.Expire(time.Now().Add(uploadIdle + time.Minute))
+	if _, err := uploads.Get(up.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Fatalf("expected abandoned upload to go got %v", err)
+	}
+}
+
+func TestExpiredUploadRemoved(t *testing.T) {
+	backend := newMemBackend()
+	uploads := NewUploads(backend, 100)
+	finish := func() Upload {
+		up, err := uploads.Create("alice", 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done, err := uploads.Write(up.ID, 0, bytes.NewReader([]byte(up.ID[:4])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return done
+	}
+	unattached, attached := finish(), finish()
+	uploads.Attached(attached.ID)
+
+	uploads.Expire(time.Now().Add(uploadIdle + time.Minute))
+	if _, found := backend.objects[unattached.CID]; !found {
+		t.Fatalf("finished upload removed before it had a day to be attached")
+	}
+	uploads.Expire(time.Now().Add(uploadKeep + time.Minute))
+	if _, found := backend.objects[unattached.CID]; found {
+		t.Fatalf("expected unattached upload to be removed from ipfs")
+	}
+	if _, found := backend.objects[attached.CID]; !found {
+		t.Fatalf("attached upload was removed")
+	}
+}
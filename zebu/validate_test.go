@@ -87,6 +87,70 @@ func TestSigning(t *testing.T) {
 	}
 }
 
+func TestTypedDataSigning(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unr := UserNameRecord{
+		CID:      "Qmd8fBSQeJ2MNkALQiLCFihymSAM4o7i13VnEJSAofAZWb",
+		Sequence: 6,
+		PubKey:   crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		Scheme:   EIP712Scheme,
+	}
+	if err := unr.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	if !unr.Validate() {
+		t.Fatalf("failed to validate %v", unr)
+	}
+
+	//same signature under the other scheme shouldn't work
+	legacy := unr
+	legacy.Scheme = LegacyScheme
+	if legacy.Validate() {
+		t.Fatalf("typed signature validated as legacy")
+	}
+
+	bumped := unr
+	bumped.Sequence = 7
+	if bumped.Validate() {
+		t.Fatalf("changed sequence still validated")
+	}
+
+	unknown := unr
+	unknown.Scheme = "rot13"
+	if unknown.Validate() {
+		t.Fatalf("unknown scheme validated")
+	}
+}
+
+func TestPostSignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	author := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	post := Post{Content: "QmP95DscnxiNzzDJ7wcivJNKe1xNCRzxh8Td9Uo5focKpZ", Created: time.Now().UTC(), Author: author}
+	if status := post.SignatureStatus(author); status != SignatureMissing {
+		t.Fatalf("expected unsigned got %s", status)
+	}
+	if err := post.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	if status := post.SignatureStatus(author); status != SignatureValid {
+		t.Fatalf("expected valid got %s", status)
+	}
+	if status := post.SignatureStatus(account); status != SignatureMismatch {
+		t.Fatalf("someone else shouldn't validate got %s", status)
+	}
+	//rechaining a signed post into someone elses history changes what was signed.
+	post.Previous = "QmYpdmbS3m677XLjixE6YkeMxCcnAvxmksWiubK4pigiFw"
+	if status := post.SignatureStatus(author); status != SignatureMismatch {
+		t.Fatalf("tampered post shouldn't validate got %s", status)
+	}
+}
+
 //Tests that Post PrettyCreate returns expected old and recent values
 func TestPrettyCreated(t *testing.T) {
 